@@ -0,0 +1,356 @@
+package perms
+
+import "github.com/pkg/errors"
+
+//ErrUnrepresentable is returned when the result of a set operation cannot be
+//expressed as a single list of nodes
+var ErrUnrepresentable = errors.New("result cannot be represented as a list of nodes")
+
+//freshPart is a namespace that no parsed node can contain.
+//It stands in for "any namespace not mentioned by a pattern".
+const freshPart = " "
+
+//trailing checks if the last namespace of n is a wildcard.
+//A trailing wildcard matches one or more namespaces, any other wildcard matches exactly one.
+func (n Node) trailing() bool {
+	return len(n.Parts) > 0 && n.Parts[len(n.Parts)-1] == WildcardSelector
+}
+
+//Covers checks if every node matched by b is also matched by a.
+//It is unaware of negation.
+func Covers(a Node, b Node) bool {
+	m, k := len(a.Parts), len(b.Parts)
+	if m == 0 || k == 0 {
+		return m == k
+	}
+
+	fixed := m
+	if a.trailing() {
+		if k < m {
+			return false
+		}
+		fixed = m - 1
+	} else if b.trailing() || k != m {
+		return false
+	}
+
+	for i := 0; i < fixed; i++ {
+		if a.Parts[i] == WildcardSelector {
+			continue
+		}
+		if b.Parts[i] != a.Parts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//intersect returns a node matching exactly the nodes matched by both a and b.
+//ok is false if no node is matched by both.
+func intersect(a Node, b Node) (n Node, ok bool) {
+	combine := func(x, y string) (string, bool) {
+		switch {
+		case x == WildcardSelector:
+			return y, true
+		case y == WildcardSelector, x == y:
+			return x, true
+		}
+		return "", false
+	}
+
+	m, k := len(a.Parts), len(b.Parts)
+	if m == 0 || k == 0 {
+		return Node{}, false
+	}
+
+	ta, tb := a.trailing(), b.trailing()
+	if tb && !ta {
+		a, b, m, k, ta, tb = b, a, k, m, tb, ta
+	}
+
+	var parts []string
+	switch {
+	case !ta && !tb:
+		if m != k {
+			return Node{}, false
+		}
+		parts = make([]string, m)
+		for i := range parts {
+			if parts[i], ok = combine(a.Parts[i], b.Parts[i]); !ok {
+				return Node{}, false
+			}
+		}
+	case !tb:
+		if k < m {
+			return Node{}, false
+		}
+		parts = make([]string, k)
+		copy(parts, b.Parts)
+		for i := 0; i < m-1; i++ {
+			if parts[i], ok = combine(a.Parts[i], b.Parts[i]); !ok {
+				return Node{}, false
+			}
+		}
+	default:
+		l := m
+		if k > l {
+			l = k
+		}
+		parts = make([]string, l)
+		for i := 0; i < l-1; i++ {
+			x, y := WildcardSelector, WildcardSelector
+			if i < m-1 {
+				x = a.Parts[i]
+			}
+			if i < k-1 {
+				y = b.Parts[i]
+			}
+			if parts[i], ok = combine(x, y); !ok {
+				return Node{}, false
+			}
+		}
+		parts[l-1] = WildcardSelector
+	}
+	return Node{Parts: parts}, true
+}
+
+//coveredBy checks if every node matched by r is matched by at least one of ps.
+//
+//Only namespaces named by a pattern are ever compared, so it is enough to
+//check r with every wildcard replaced by a namespace nobody mentions,
+//at every length up to one past the longest pattern.
+func coveredBy(r Node, ps []Node) bool {
+	if len(ps) == 0 {
+		return false
+	}
+
+	k := len(r.Parts)
+	longest := k
+	for _, p := range ps {
+		if len(p.Parts) > longest {
+			longest = len(p.Parts)
+		}
+	}
+
+	last := k
+	if r.trailing() {
+		last = longest + 1
+	}
+
+	for l := k; l <= last; l++ {
+		witness := Node{Parts: make([]string, l)}
+		for i := range witness.Parts {
+			witness.Parts[i] = freshPart
+			if i < k && r.Parts[i] != WildcardSelector {
+				witness.Parts[i] = r.Parts[i]
+			}
+		}
+
+		var matched bool
+		for _, p := range ps {
+			if p.Match(witness) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+//split separates ns into its granting and negating nodes
+func (ns Nodes) split() (grants []Node, negations []Node) {
+	for _, n := range ns {
+		if n.Negate {
+			negations = append(negations, n)
+		} else {
+			grants = append(grants, n)
+		}
+	}
+	return grants, negations
+}
+
+//within checks if every node matched by r and by none of minus is granted by ns
+func (ns Nodes) within(r Node, minus []Node) bool {
+	grants, negations := ns.split()
+
+	cover := make([]Node, 0, len(minus)+len(grants))
+	cover = append(cover, minus...)
+	cover = append(cover, grants...)
+	if !coveredBy(r, cover) {
+		return false
+	}
+
+	for _, neg := range negations {
+		if c, ok := intersect(r, neg); ok && !coveredBy(c, minus) {
+			return false
+		}
+	}
+	return true
+}
+
+//disjoint checks if no node matched by r is granted by ns
+func (ns Nodes) disjoint(r Node) bool {
+	grants, negations := ns.split()
+	for _, g := range grants {
+		if c, ok := intersect(r, g); ok && !coveredBy(c, negations) {
+			return false
+		}
+	}
+	return true
+}
+
+//Overlaps checks if ns grants any node matched by n.
+//It is unaware of the negation of n.
+func (ns Nodes) Overlaps(n Node) bool {
+	return !ns.disjoint(n)
+}
+
+//subsetOf checks if every node granted by ns is granted by other
+func (ns Nodes) subsetOf(other Nodes) bool {
+	grants, negations := ns.split()
+	for _, g := range grants {
+		if !other.within(g, negations) {
+			return false
+		}
+	}
+	return true
+}
+
+//appendUnique appends n to ns unless an identical node is already present
+func appendUnique(ns Nodes, n Node) Nodes {
+	str := n.String()
+	for _, existing := range ns {
+		if existing.String() == str {
+			return ns
+		}
+	}
+	return append(ns, n)
+}
+
+//negate returns a negated copy of n
+func negate(n Node) Node {
+	return Node{Parts: n.Parts, Negate: true}
+}
+
+//Equivalent checks if ns and other grant exactly the same nodes
+func (ns Nodes) Equivalent(other Nodes) bool {
+	return ns.subsetOf(other) && other.subsetOf(ns)
+}
+
+//Intersect returns the nodes granted by both ns and other
+func (ns Nodes) Intersect(other Nodes) Nodes {
+	ga, na := ns.split()
+	gb, nb := other.split()
+
+	out := make(Nodes, 0, len(ga)*len(gb)+len(na)+len(nb))
+	for _, a := range ga {
+		for _, b := range gb {
+			if c, ok := intersect(a, b); ok {
+				out = appendUnique(out, c)
+			}
+		}
+	}
+	for _, n := range append(na, nb...) {
+		out = appendUnique(out, n)
+	}
+	return out
+}
+
+//Union returns the nodes granted by either ns or other.
+//ErrUnrepresentable is returned if a negation in one list would take away
+//a node granted by the other and it cannot be narrowed to avoid it.
+func (ns Nodes) Union(other Nodes) (Nodes, error) {
+	ga, na := ns.split()
+	gb, nb := other.split()
+
+	out := make(Nodes, 0, len(ns)+len(other))
+	for _, g := range append(ga, gb...) {
+		out = appendUnique(out, g)
+	}
+
+	//negations of one side may only remain where the other side grants nothing
+	narrow := func(negations []Node, grants []Node, otherNegations []Node, other Nodes) {
+		for _, n := range negations {
+			if other.disjoint(n) {
+				out = appendUnique(out, negate(n))
+				continue
+			}
+			for _, m := range otherNegations {
+				if c, ok := intersect(n, m); ok {
+					out = appendUnique(out, negate(c))
+				}
+			}
+			for _, g := range grants {
+				if c, ok := intersect(n, g); ok && other.disjoint(c) {
+					out = appendUnique(out, negate(c))
+				}
+			}
+		}
+	}
+	narrow(na, ga, nb, other)
+	narrow(nb, gb, na, ns)
+
+	_, negations := out.split()
+	exact := func(grants []Node, ownNegations []Node, other Nodes) bool {
+		for _, g := range grants {
+			for _, n := range ownNegations {
+				if c, ok := intersect(g, n); ok && !other.within(c, negations) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if !exact(ga, na, other) || !exact(gb, nb, ns) {
+		return nil, ErrUnrepresentable
+	}
+	return out, nil
+}
+
+//Subtract returns the nodes granted by ns but not by other.
+//ErrUnrepresentable is returned if other negates part of a grant that ns
+//would otherwise lose, such as subtracting `projects.* -projects.secret` from `*`.
+func (ns Nodes) Subtract(other Nodes) (Nodes, error) {
+	ga, na := ns.split()
+	gb, nb := other.split()
+
+	out := make(Nodes, 0, len(ns)+len(gb))
+	for _, n := range ns {
+		out = appendUnique(out, n)
+	}
+
+	//a negation is safe if everything it takes away from ns is granted by other
+	safe := func(c Node) bool {
+		for _, g := range ga {
+			if r, ok := intersect(c, g); ok && !other.within(r, na) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, b := range gb {
+		if safe(b) {
+			out = appendUnique(out, negate(b))
+			continue
+		}
+		for _, a := range ga {
+			if c, ok := intersect(a, b); ok && safe(c) {
+				out = appendUnique(out, negate(c))
+			}
+		}
+	}
+
+	_, negations := out.split()
+	cover := append(negations, nb...)
+	for _, a := range ga {
+		for _, b := range gb {
+			if c, ok := intersect(a, b); ok && !coveredBy(c, cover) {
+				return nil, ErrUnrepresentable
+			}
+		}
+	}
+	return out, nil
+}
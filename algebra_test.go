@@ -0,0 +1,189 @@
+package perms
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+//quickNode generates short nodes over a tiny alphabet so that overlaps are common
+type quickNode Node
+
+func (quickNode) Generate(r *rand.Rand, size int) reflect.Value {
+	alphabet := []string{"a", "b", WildcardSelector}
+	parts := make([]string, 1+r.Intn(3))
+	for i := range parts {
+		parts[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return reflect.ValueOf(quickNode{Parts: parts, Negate: r.Intn(3) == 0})
+}
+
+type quickNodes Nodes
+
+func (quickNodes) Generate(r *rand.Rand, size int) reflect.Value {
+	ns := make(quickNodes, r.Intn(5))
+	for i := range ns {
+		ns[i] = Node(quickNode{}.Generate(r, size).Interface().(quickNode))
+	}
+	return reflect.ValueOf(ns)
+}
+
+//universe contains every node of up to 5 namespaces over a, b and c.
+//c is never generated, so it stands in for every unmentioned namespace.
+var universe = func() []Node {
+	var all []Node
+	level := [][]string{nil}
+	for l := 1; l <= 5; l++ {
+		var next [][]string
+		for _, prefix := range level {
+			for _, part := range []string{"a", "b", "c"} {
+				parts := append(append([]string{}, prefix...), part)
+				next = append(next, parts)
+				all = append(all, Node{Parts: parts})
+			}
+		}
+		level = next
+	}
+	return all
+}()
+
+func granted(ns Nodes, check Node) bool {
+	matched, negated := ns.Check(check)
+	return matched && !negated
+}
+
+//agrees checks ns against want for every node in the universe
+func agrees(ns Nodes, want func(Node) bool) bool {
+	for _, u := range universe {
+		if granted(ns, u) != want(u) {
+			return false
+		}
+	}
+	return true
+}
+
+var quickConfig = &quick.Config{MaxCount: 2000, Rand: rand.New(rand.NewSource(1))}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"projects.*", "projects.x.*", true},
+		{"projects.*", "projects.x", true},
+		{"projects.*", "projects", false},
+		{"projects.x.*", "projects.*", false},
+		{"projects.*.chat.use", "projects.webserver.chat.use", true},
+		{"projects.*.chat.use", "projects.*.chat.*", false},
+		{"*", "-billing.*", true},
+		{"projects.x", "projects.*", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			if got := Covers(MustParseNode(tt.a), MustParseNode(tt.b)); got != tt.want {
+				t.Errorf("Covers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	property := func(a, b quickNode) bool {
+		want := true
+		for _, u := range universe {
+			if Node(b).Match(u) && !Node(a).Match(u) {
+				want = false
+				break
+			}
+		}
+		return Covers(Node(a), Node(b)) == want
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodes_Intersect(t *testing.T) {
+	property := func(a, b quickNodes) bool {
+		got := Nodes(a).Intersect(Nodes(b))
+		return agrees(got, func(u Node) bool {
+			return granted(Nodes(a), u) && granted(Nodes(b), u)
+		})
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodes_Union(t *testing.T) {
+	property := func(a, b quickNodes) bool {
+		got, err := Nodes(a).Union(Nodes(b))
+		if err != nil {
+			_, na := Nodes(a).split()
+			_, nb := Nodes(b).split()
+			//without negations a union is always representable
+			return err == ErrUnrepresentable && len(na)+len(nb) > 0
+		}
+		return agrees(got, func(u Node) bool {
+			return granted(Nodes(a), u) || granted(Nodes(b), u)
+		})
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodes_Subtract(t *testing.T) {
+	property := func(a, b quickNodes) bool {
+		got, err := Nodes(a).Subtract(Nodes(b))
+		if err != nil {
+			_, nb := Nodes(b).split()
+			return err == ErrUnrepresentable && len(nb) > 0
+		}
+		return agrees(got, func(u Node) bool {
+			return granted(Nodes(a), u) && !granted(Nodes(b), u)
+		})
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("unrepresentable", func(t *testing.T) {
+		a := MustParseNodes(strings.NewReader("*"))
+		b := MustParseNodes(strings.NewReader("projects.* -projects.secret"))
+		if _, err := a.Subtract(b); err != ErrUnrepresentable {
+			t.Errorf("Subtract() error = %v, want %v", err, ErrUnrepresentable)
+		}
+	})
+
+	t.Run("groups", func(t *testing.T) {
+		a := MustParseNodes(strings.NewReader("projects.* analytics.*"))
+		b := MustParseNodes(strings.NewReader("projects.webserver.*"))
+		got, err := a.Subtract(b)
+		if err != nil {
+			t.Fatalf("Subtract() error = %v", err)
+		}
+		want := "projects.*\nanalytics.*\n-projects.webserver.*"
+		if got.String() != want {
+			t.Errorf("Subtract() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestNodes_Equivalent(t *testing.T) {
+	property := func(a, b quickNodes) bool {
+		want := agrees(Nodes(a), func(u Node) bool {
+			return granted(Nodes(b), u)
+		})
+		return Nodes(a).Equivalent(Nodes(b)) == want
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+
+	a := MustParseNodes(strings.NewReader("projects.* projects.webserver.build"))
+	b := MustParseNodes(strings.NewReader("projects.*"))
+	if !a.Equivalent(b) {
+		t.Errorf("%q should be equivalent to %q", a, b)
+	}
+}
@@ -0,0 +1,170 @@
+package perms
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//audited actions
+const (
+	AuditAddUser  = "add-user"
+	AuditDelUser  = "del-user"
+	AuditAddGroup = "add-group"
+	AuditDelGroup = "del-group"
+	AuditAddPConf = "add-pconf"
+	AuditReset    = "reset"
+	AuditRollback = "rollback"
+	AuditUpdate   = "update"
+)
+
+//AuditEntity is the state of a user or group in an AuditEvent
+type AuditEntity struct {
+	Parents []string `json:"parents,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Nodes   []string `json:"nodes,omitempty"`
+}
+
+//AuditEvent records a change to a user or group of a Web
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor,omitempty"`
+	Action string    `json:"action"`
+	//Kind is user or group
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	//Source is the source given to AddPConfFrom
+	Source string `json:"source,omitempty"`
+	//Before is nil if the entity did not exist and After is nil if it no longer does
+	Before *AuditEntity `json:"before,omitempty"`
+	After  *AuditEntity `json:"after,omitempty"`
+}
+
+//AuditSink records audit events
+type AuditSink interface {
+	Record(e AuditEvent) error
+}
+
+//AuditFunc is an AuditSink which calls itself
+type AuditFunc func(e AuditEvent) error
+
+//Record calls f
+func (f AuditFunc) Record(e AuditEvent) error {
+	return f(e)
+}
+
+//auditGroup returns the audited state of g, or nil if g is nil
+func auditGroup(g *Group) *AuditEntity {
+	if g == nil {
+		return nil
+	}
+	return &AuditEntity{Parents: append([]string{}, g.Parents...), Nodes: g.Nodes.Strings()}
+}
+
+//auditUser returns the audited state of u, or nil if u is nil
+func auditUser(u *User) *AuditEntity {
+	if u == nil {
+		return nil
+	}
+	return &AuditEntity{Groups: append([]string{}, u.Groups...), Nodes: u.Nodes.Strings()}
+}
+
+//groupState returns the audited state of the group with name as it was last added to w, or nil if there is none
+func (w *Web) groupState(name string) *AuditEntity {
+	if w.groups[name] == nil {
+		return nil
+	}
+	return w.groupStates[name]
+}
+
+//userState returns the audited state of the user with name as it was last added to w, or nil if there is none
+func (w *Web) userState(name string) *AuditEntity {
+	if w.user(name) == nil {
+		return nil
+	}
+	return w.userStates[name]
+}
+
+//SetAuditSink records every change made by AddUser, DelUser, AddGroup, DelGroup, AddPConf, Reset, Rollback and Update to sink,
+//one event for each user or group changed.
+//Events are recorded once the change has been made. If recording fails, the error is returned but the change is kept.
+//Loading a store with SetStore and rebuilding w with SetNormalization are not recorded.
+//A nil sink stops recording.
+func (w *Web) SetAuditSink(sink AuditSink) {
+	w.audit = sink
+}
+
+//SetActor sets the actor recorded in the audit events of the changes which follow
+func (w *Web) SetActor(actor string) {
+	w.actor = actor
+}
+
+//record records events stamped with the time and actor.
+//Every event is recorded even if one fails.
+func (w *Web) record(events ...AuditEvent) error {
+	if w.audit == nil {
+		return nil
+	}
+	var err error
+	now := time.Now()
+	for _, e := range events {
+		e.Time, e.Actor = now, w.actor
+		if recordErr := w.audit.Record(e); recordErr != nil && err == nil {
+			err = errors.Wrap(recordErr, "failed to record audit event")
+		}
+	}
+	return err
+}
+
+//JSONLinesSink is an AuditSink which writes each event as a line of JSON.
+//It is safe for concurrent use.
+type JSONLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+//NewJSONLinesSink returns a sink writing to w
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+//OpenAuditLog returns a sink appending to the file at path, which is created if it does not exist.
+//Each event is synced to disk before Record returns.
+func OpenAuditLog(path string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open audit log")
+	}
+	return NewJSONLinesSink(f), nil
+}
+
+//Record writes e as a line of JSON
+func (s *JSONLinesSink) Record(e AuditEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if f, ok := s.w.(*os.File); ok {
+		return f.Sync()
+	}
+	return nil
+}
+
+//Close closes the writer of s if it is an io.Closer
+func (s *JSONLinesSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package perms
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestWeb_SetAuditSink(t *testing.T) {
+	var events []AuditEvent
+	web := testWeb()
+	web.SetAuditSink(AuditFunc(func(e AuditEvent) error {
+		if e.Time.IsZero() {
+			t.Errorf("event %v has no time", e.Action)
+		}
+		e.Time = time.Time{}
+		events = append(events, e)
+		return nil
+	}))
+
+	web.SetActor("alice")
+	web.AddUser(&User{Name: "carl", Groups: []string{"manager"}})
+	web.DelGroup("default")
+	web.SetActor("bob")
+	web.SetMergeStrategy(MergeAppend)
+	web.AddPConfFrom("extra.json", MustParsePConf([]byte(`{"users": {"carl": {"nodes": ["analytics.view"]}}}`)))
+	web.DelUser("nobody")
+
+	want := []AuditEvent{
+		{Actor: "alice", Action: AuditAddUser, Kind: "user", Name: "carl",
+			After: &AuditEntity{Groups: []string{"manager"}, Nodes: []string{}}},
+		{Actor: "alice", Action: AuditDelGroup, Kind: "group", Name: "default",
+			Before: &AuditEntity{Parents: []string{}, Nodes: []string{"profile.use"}}},
+		{Actor: "bob", Action: AuditAddPConf, Kind: "user", Name: "carl", Source: "extra.json",
+			Before: &AuditEntity{Groups: []string{"manager"}, Nodes: []string{}},
+			After:  &AuditEntity{Groups: []string{"manager"}, Nodes: []string{"analytics.view"}}},
+		{Actor: "bob", Action: AuditDelUser, Kind: "user", Name: "nobody"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+
+	//loading and renormalizing are not changes
+	events = nil
+	web.SetNormalization(Normalization{FoldCase: true})
+	web.SetStore(NewMemoryStore())
+	if len(events) != 0 {
+		t.Errorf("recorded %+v", events)
+	}
+	web.AddPConf(testWeb().MasterPConf())
+	events = nil
+	web.Reset()
+	if len(events) != 5 || events[0].Action != AuditReset || events[0].After != nil {
+		t.Errorf("Reset() recorded %+v, want an event for every user and group", events)
+	}
+
+	//a failing sink does not undo the change
+	web.SetAuditSink(AuditFunc(func(AuditEvent) error { return errStore }))
+	if err := web.AddGroup(&Group{Name: "auditor"}); errors.Cause(err) != errStore || web.GetGroup("auditor") == nil {
+		t.Errorf("AddGroup() = %v with a failing sink, want the error and the group", err)
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	buf := new(bytes.Buffer)
+	web := NewWeb()
+	web.SetAuditSink(NewJSONLinesSink(buf))
+	web.SetActor("alice")
+	web.AddGroup(&Group{Name: "manager", Nodes: MustParseNodes(strings.NewReader("projects.*"))})
+	web.DelGroup("manager")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %q, want 2 lines", buf)
+	}
+	var e AuditEvent
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Actor != "alice" || e.Action != AuditDelGroup || e.Name != "manager" || e.Before == nil || e.Before.Nodes[0] != "projects.*" {
+		t.Errorf("decoded %+v from %s", e, lines[1])
+	}
+}
+
+func TestOpenAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	//the log is appended to each time it is opened
+	for i := 0; i < 2; i++ {
+		sink, err := OpenAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		web := NewWeb()
+		web.SetAuditSink(sink)
+		web.AddUser(&User{Name: "carl"})
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	byt, _ := ioutil.ReadFile(path)
+	if lines := strings.Count(string(byt), "\n"); lines != 2 {
+		t.Errorf("log has %v lines, want 2", lines)
+	}
+}
+
+func TestWeb_SetAuditSink_ChangedPointer(t *testing.T) {
+	web := testWeb()
+	var audited []AuditEvent
+	web.SetAuditSink(AuditFunc(func(e AuditEvent) error {
+		audited = append(audited, e)
+		return nil
+	}))
+	var events []Event
+	web.Subscribe(func(e Event) { events = append(events, e) })
+
+	//change users and groups in place and pass them back, as SetStore documents
+	bob := web.GetUser("bob")
+	bob.Nodes = append(bob.Nodes, MustParseNode("billing.*"))
+	web.AddUser(bob)
+	manager := web.GetGroup("manager")
+	manager.Parents = append(manager.Parents, "project_lead")
+	web.AddGroup(manager)
+
+	if len(audited) != 2 {
+		t.Fatalf("audited %+v", audited)
+	}
+	if before := audited[0].Before; before == nil || len(before.Nodes) != 0 {
+		t.Errorf("Before = %+v, want bob without billing.*", before)
+	}
+	if before := audited[1].Before; before == nil || len(before.Parents) != 0 {
+		t.Errorf("Before = %+v, want manager without parents", before)
+	}
+	want := []Event{
+		{Type: UserNodesChanged, Name: "bob", Added: []string{"billing.*"}},
+		{Type: GroupParentsChanged, Name: "manager", Added: []string{"project_lead"}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stratexio/perms"
+	"github.com/stratexio/perms/lint"
+)
+
+//formatOf returns the format of a pconf file, assuming JSON for unknown extensions
+func formatOf(file string) perms.Format {
+	if format, err := perms.FormatOf(file); err == nil {
+		return format
+	}
+	return perms.FormatJSON
+}
+
+//readPConf reads and parses a pconf file in the format its extension names
+func readPConf(file string) (*perms.PConf, perms.Format, error) {
+	format := formatOf(file)
+	byt, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, format, err
+	}
+	pconf, err := perms.ParsePConfFormat(byt, format)
+	if err != nil {
+		return nil, format, errors.Wrap(err, file)
+	}
+	return pconf, format, nil
+}
+
+//marshal encodes pconf in format, ending with a newline
+func marshal(pconf *perms.PConf, format perms.Format) ([]byte, error) {
+	byt, err := pconf.MarshalFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(byt, []byte("\n")) {
+		byt = append(byt, '\n')
+	}
+	return byt, nil
+}
+
+//strategies maps the values of -merge to merge strategies
+var strategies = map[string]perms.MergeStrategy{
+	perms.MergeReplace.String(): perms.MergeReplace,
+	perms.MergeAppend.String():  perms.MergeAppend,
+	perms.MergeError.String():   perms.MergeError,
+}
+
+//mergeStrategy returns the merge strategy given with -merge, MergeReplace if there is none
+func (env *env) mergeStrategy() (perms.MergeStrategy, error) {
+	if env.merge == "" {
+		return perms.MergeReplace, nil
+	}
+	strategy, ok := strategies[env.merge]
+	if !ok {
+		return 0, errors.Errorf("unknown merge strategy %q", env.merge)
+	}
+	return strategy, nil
+}
+
+//loadWeb assembles a web from pconf files and the files they include in order
+func (env *env) loadWeb(files []string) (*perms.Web, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no pconf files given")
+	}
+	strategy, err := env.mergeStrategy()
+	if err != nil {
+		return nil, err
+	}
+	web := perms.NewWeb()
+	web.SetMergeStrategy(strategy)
+	for _, file := range files {
+		if err := web.LoadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	return web, nil
+}
+
+//splitArgs separates the pconf files from the n arguments following them
+func splitArgs(args []string, n int) (files []string, rest []string, err error) {
+	if len(args) < n+1 {
+		return nil, nil, errors.Errorf("expected at least %v arguments, got %v", n+1, len(args))
+	}
+	return args[:len(args)-n], args[len(args)-n:], nil
+}
+
+//encode writes v to env's standard output as a line of json
+func (env *env) encode(v interface{}) error {
+	return json.NewEncoder(env.stdout).Encode(v)
+}
+
+//verdict returns the exit status of a check
+func verdict(allowed bool) int {
+	if allowed {
+		return exitOK
+	}
+	return exitFailed
+}
+
+func runCheck(env *env, args []string) (int, error) {
+	files, rest, err := splitArgs(args, 2)
+	if err != nil {
+		return exitError, err
+	}
+	web, err := env.loadWeb(files)
+	if err != nil {
+		return exitError, err
+	}
+	node, err := web.ParseNode(rest[1])
+	if err != nil {
+		return exitError, errors.Wrapf(err, "failed to parse node %q", rest[1])
+	}
+
+	allowed := web.CheckUserHasPermission(rest[0], node)
+	if env.json {
+		return verdict(allowed), env.encode(struct {
+			User    string     `json:"user"`
+			Node    perms.Node `json:"node"`
+			Allowed bool       `json:"allowed"`
+		}{rest[0], node, allowed})
+	}
+	if allowed {
+		fmt.Fprintln(env.stdout, "allowed")
+	} else {
+		fmt.Fprintln(env.stdout, "denied")
+	}
+	return verdict(allowed), nil
+}
+
+func runExplain(env *env, args []string) (int, error) {
+	files, rest, err := splitArgs(args, 2)
+	if err != nil {
+		return exitError, err
+	}
+	web, err := env.loadWeb(files)
+	if err != nil {
+		return exitError, err
+	}
+	node, err := web.ParseNode(rest[1])
+	if err != nil {
+		return exitError, errors.Wrapf(err, "failed to parse node %q", rest[1])
+	}
+
+	explanation := web.Explain(rest[0], node)
+	if env.json {
+		type step struct {
+			Group   string   `json:"group,omitempty"`
+			Matched []string `json:"matched"`
+			Negated bool     `json:"negated"`
+		}
+		steps := make([]step, len(explanation.Steps))
+		for i, s := range explanation.Steps {
+			steps[i] = step{Group: s.Group, Matched: s.Matched.Strings(), Negated: s.Negated}
+		}
+		return verdict(explanation.Allowed), env.encode(struct {
+			User    string     `json:"user"`
+			Node    perms.Node `json:"node"`
+			Allowed bool       `json:"allowed"`
+			Reason  string     `json:"reason"`
+			Steps   []step     `json:"steps"`
+		}{explanation.User, explanation.Node, explanation.Allowed, explanation.Reason, steps})
+	}
+	fmt.Fprint(env.stdout, explanation)
+	return verdict(explanation.Allowed), nil
+}
+
+func runEffective(env *env, args []string) (int, error) {
+	files, rest, err := splitArgs(args, 1)
+	if err != nil {
+		return exitError, err
+	}
+	web, err := env.loadWeb(files)
+	if err != nil {
+		return exitError, err
+	}
+
+	effective, err := web.Effective(rest[0])
+	if err != nil {
+		return exitError, err
+	}
+	//a single list is only possible if the user doesn't grant what its groups negate
+	combined, err := effective.Nodes()
+	if err != nil && err != perms.ErrUnrepresentable {
+		return exitError, err
+	}
+
+	if env.json {
+		out := struct {
+			User   string   `json:"user"`
+			Nodes  []string `json:"nodes,omitempty"`
+			Own    []string `json:"own"`
+			Groups []string `json:"groups"`
+		}{User: rest[0], Own: effective.User.Strings(), Groups: effective.Groups.Strings()}
+		if combined != nil {
+			out.Nodes = combined.Strings()
+		}
+		return exitOK, env.encode(out)
+	}
+
+	if combined != nil {
+		for _, n := range combined {
+			fmt.Fprintln(env.stdout, n)
+		}
+		return exitOK, nil
+	}
+	fmt.Fprintf(env.stdout, "%v Own Nodes:\n", len(effective.User))
+	for _, n := range effective.User {
+		fmt.Fprintf(env.stdout, "   %v\n", n)
+	}
+	fmt.Fprintf(env.stdout, "%v Group Nodes:\n", len(effective.Groups))
+	for _, n := range effective.Groups {
+		fmt.Fprintf(env.stdout, "   %v\n", n)
+	}
+	return exitOK, nil
+}
+
+func runWhoHas(env *env, args []string) (int, error) {
+	files, rest, err := splitArgs(args, 1)
+	if err != nil {
+		return exitError, err
+	}
+	web, err := env.loadWeb(files)
+	if err != nil {
+		return exitError, err
+	}
+	node, err := web.ParseNode(rest[0])
+	if err != nil {
+		return exitError, errors.Wrapf(err, "failed to parse node %q", rest[0])
+	}
+
+	users := web.UsersWithPermission(node)
+	if env.json {
+		return exitOK, env.encode(users)
+	}
+	for _, user := range users {
+		fmt.Fprintln(env.stdout, user)
+	}
+	return exitOK, nil
+}
+
+func runLint(env *env, args []string) (int, error) {
+	if len(args) == 0 {
+		return exitError, errors.New("no pconf files given")
+	}
+
+	registry, err := env.readRegistry()
+	if err != nil {
+		return exitError, err
+	}
+	strategy, err := env.mergeStrategy()
+	if err != nil {
+		return exitError, err
+	}
+	config := lint.Config{
+		BroadGroups: splitList(env.broadGroups),
+		BroadUsers:  splitList(env.broadUsers),
+		Registry:    registry,
+		Merge:       strategy,
+	}
+
+	sources := make([]lint.Source, 0, len(args))
+	for _, file := range args {
+		files, err := perms.ReadPConfFile(file)
+		if err != nil {
+			return exitError, err
+		}
+		for _, f := range files {
+			sources = append(sources, lint.Source{File: f.File, PConf: f.PConf})
+		}
+	}
+
+	findings := lint.Lint(sources, config)
+	if env.json {
+		if findings == nil {
+			findings = []lint.Finding{}
+		}
+		if err := env.encode(findings); err != nil {
+			return exitError, err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Fprintln(env.stdout, f)
+		}
+	}
+	if len(findings) > 0 {
+		return exitFailed, nil
+	}
+	return exitOK, nil
+}
+
+//readRegistry reads the registry file given with -registry, if any
+func (env *env) readRegistry() (*perms.Registry, error) {
+	if env.registry == "" {
+		return nil, nil
+	}
+	byt, err := ioutil.ReadFile(env.registry)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := perms.ParseRegistry(byt)
+	if err != nil {
+		return nil, errors.Wrap(err, env.registry)
+	}
+	return registry, nil
+}
+
+//splitList splits a comma separated list
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+//format returns the canonical form of a pconf file.
+//DSL files keep their comments and order.
+func format(file string) ([]byte, error) {
+	if formatOf(file) != perms.FormatDSL {
+		pconf, format, err := readPConf(file)
+		if err != nil {
+			return nil, err
+		}
+		byt, err := marshal(pconf, format)
+		return byt, errors.Wrap(err, file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := perms.ParseDSL(f)
+	if err != nil {
+		return nil, errors.Wrap(err, file)
+	}
+	buf := new(bytes.Buffer)
+	err = perms.WriteDSL(buf, d.PConf(), d)
+	return buf.Bytes(), errors.Wrap(err, file)
+}
+
+func runFmt(env *env, args []string) (int, error) {
+	if len(args) == 0 {
+		return exitError, errors.New("no pconf files given")
+	}
+	for _, file := range args {
+		byt, err := format(file)
+		if err != nil {
+			return exitError, err
+		}
+
+		if env.write {
+			if err := ioutil.WriteFile(file, byt, 0644); err != nil {
+				return exitError, err
+			}
+			continue
+		}
+		if _, err := env.stdout.Write(byt); err != nil {
+			return exitError, err
+		}
+	}
+	return exitOK, nil
+}
+
+func runMerge(env *env, args []string) (int, error) {
+	web, err := env.loadWeb(args)
+	if err != nil {
+		return exitError, err
+	}
+
+	var byt []byte
+	switch {
+	case env.json:
+		byt, err = web.MasterPConf().Marshal()
+		byt = append(byt, '\n')
+	case env.output != "":
+		byt, err = marshal(web.MasterPConf(), formatOf(env.output))
+	default:
+		byt, err = marshal(web.MasterPConf(), perms.FormatJSON)
+	}
+	if err != nil {
+		return exitError, err
+	}
+
+	if env.output != "" {
+		return exitOK, ioutil.WriteFile(env.output, byt, 0644)
+	}
+	_, err = env.stdout.Write(byt)
+	return exitOK, err
+}
+
+func runDiff(env *env, args []string) (int, error) {
+	if len(args) != 2 {
+		return exitError, errors.Errorf("expected 2 arguments, got %v", len(args))
+	}
+	before, err := env.loadWeb(args[:1])
+	if err != nil {
+		return exitError, err
+	}
+	after, err := env.loadWeb(args[1:])
+	if err != nil {
+		return exitError, err
+	}
+
+	registry, err := env.readRegistry()
+	if err != nil {
+		return exitError, err
+	}
+	before.SetRegistry(registry)
+	after.SetRegistry(registry)
+
+	var probes perms.Nodes
+	for _, nodeStr := range splitList(env.probes) {
+		node, err := after.ParseNode(nodeStr)
+		if err != nil {
+			return exitError, errors.Wrapf(err, "failed to parse node %q", nodeStr)
+		}
+		probes = append(probes, node)
+	}
+
+	d := perms.Diff(before, after, probes)
+	if env.json {
+		err = env.encode(d)
+	} else {
+		_, err = fmt.Fprint(env.stdout, d)
+	}
+	if err != nil {
+		return exitError, err
+	}
+	if !d.Empty() {
+		return exitFailed, nil
+	}
+	return exitOK, nil
+}
+
+func runSchema(env *env, args []string) (int, error) {
+	if len(args) != 0 {
+		return exitError, errors.Errorf("expected no arguments, got %v", len(args))
+	}
+	schema, err := perms.PConfSchema()
+	if err != nil {
+		return exitError, err
+	}
+	_, err = env.stdout.Write(append(schema, '\n'))
+	return exitOK, err
+}
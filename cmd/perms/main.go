@@ -0,0 +1,149 @@
+//Command perms inspects and edits permission configurations.
+//
+//Usage:
+//
+//	perms <command> [flags] [arguments]
+//
+//The commands are:
+//
+//	check     <pconf...> <user> <node>   check if a user has a permission
+//	explain   <pconf...> <user> <node>   describe which nodes decide a check
+//	effective <pconf...> <user>          list the nodes a user is granted
+//	who-has   <pconf...> <node>          list the users who have a permission
+//	lint      <pconf...>                 report likely mistakes
+//	fmt       <pconf...>                 canonicalize pconfs
+//	merge     <pconf...>                 combine pconfs into a master pconf
+//	diff      <before> <after>           report changes and who gains or loses which permissions
+//	schema                               print the JSON Schema of pconfs
+//
+//Every command accepts -json for machine readable output.
+//Commands which read several pconfs accept -merge to choose how users and groups
+//declared more than once are combined: replace (the default), append or error.
+//check and explain exit with status 1 if the permission is denied,
+//lint and diff exit with status 1 if they find anything. Errors exit with status 2.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+//exit statuses
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitError  = 2
+)
+
+//command is a subcommand of perms
+type command struct {
+	usage string
+	//run executes the command with the arguments left after flags are parsed.
+	//It returns the exit status.
+	run func(env *env, args []string) (int, error)
+	//flags registers the command's own flags
+	flags func(fs *flag.FlagSet, env *env)
+}
+
+//env contains the state shared by every command
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+	json   bool
+	//flags specific to a command
+	write       bool
+	output      string
+	registry    string
+	broadGroups string
+	broadUsers  string
+	probes      string
+	merge       string
+}
+
+//mergeFlag registers -merge for commands which assemble a web
+func mergeFlag(fs *flag.FlagSet, env *env) {
+	fs.StringVar(&env.merge, "merge", "replace", "how users and groups declared by several pconfs are combined: replace, append or error")
+}
+
+var commands = map[string]command{
+	"check":     {usage: "[-merge strategy] <pconf...> <user> <node>", run: runCheck, flags: mergeFlag},
+	"explain":   {usage: "[-merge strategy] <pconf...> <user> <node>", run: runExplain, flags: mergeFlag},
+	"effective": {usage: "[-merge strategy] <pconf...> <user>", run: runEffective, flags: mergeFlag},
+	"who-has":   {usage: "[-merge strategy] <pconf...> <node>", run: runWhoHas, flags: mergeFlag},
+	"lint": {usage: "[-merge strategy] [-registry file] [-broad-groups list] [-broad-users list] <pconf...>", run: runLint, flags: func(fs *flag.FlagSet, env *env) {
+		mergeFlag(fs, env)
+		fs.StringVar(&env.registry, "registry", "", "registry file to find unknown nodes with")
+		fs.StringVar(&env.broadGroups, "broad-groups", "", "comma separated groups which may be granted every permission")
+		fs.StringVar(&env.broadUsers, "broad-users", "", "comma separated users who may be granted every permission")
+	}},
+	"fmt": {usage: "[-w] <pconf...>", run: runFmt, flags: func(fs *flag.FlagSet, env *env) {
+		fs.BoolVar(&env.write, "w", false, "write the result to the pconf instead of standard output")
+	}},
+	"merge": {usage: "[-merge strategy] [-o file] <pconf...>", run: runMerge, flags: func(fs *flag.FlagSet, env *env) {
+		mergeFlag(fs, env)
+		fs.StringVar(&env.output, "o", "", "file to write in the format its extension names, standard output if empty")
+	}},
+	"schema": {usage: "", run: runSchema},
+	"diff": {usage: "[-merge strategy] [-registry file] [-probes list] <before> <after>", run: runDiff, flags: func(fs *flag.FlagSet, env *env) {
+		mergeFlag(fs, env)
+		fs.StringVar(&env.registry, "registry", "", "registry file whose permissions are probed")
+		fs.StringVar(&env.probes, "probes", "", "comma separated nodes to probe instead of the registry")
+	}},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "usage: perms <command> [-json] [arguments]\n\ncommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "   %-10v %v\n", name, commands[name].usage)
+	}
+}
+
+//run executes the command in args and returns the exit status
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitError
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "perms: unknown command %q\n\n", args[0])
+		usage(stderr)
+		return exitError
+	}
+
+	env := &env{stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&env.json, "json", false, "output json")
+	if cmd.flags != nil {
+		cmd.flags(fs, env)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: perms %v %v\n", args[0], cmd.usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitError
+	}
+
+	status, err := cmd.run(env, fs.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "perms %v: %v\n", args[0], err)
+		return exitError
+	}
+	return status
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testGroups = `{
+    "groups": {
+        "project_lead": {
+            "nodes": ["analytics.*"]
+        },
+        "manager": {
+            "parents": ["project_lead"],
+            "nodes": ["projects.*", "projects.webserver.build"]
+        }
+    }
+}`
+
+const testUsers = `{"users": {"ammar": {"groups": ["manager", "project_lead"], "nodes": ["-projects.*.chat.moderate"]}, "bob": {"groups": ["project_lead"]}}}`
+
+//writeFiles writes pconfs into a temporary directory and returns their paths
+func writeFiles(t *testing.T, contents ...string) []string {
+	dir, err := ioutil.TempDir("", "perms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	files := make([]string, len(contents))
+	for i, content := range contents {
+		files[i] = filepath.Join(dir, string(rune('a'+i))+".json")
+		if err := ioutil.WriteFile(files[i], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+//runArgs runs perms and returns its exit status and standard output
+func runArgs(t *testing.T, args ...string) (int, string) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	status := run(args, stdout, stderr)
+	if status == exitError {
+		t.Logf("stderr: %s", stderr)
+	}
+	return status, stdout.String()
+}
+
+func TestCheck(t *testing.T) {
+	files := writeFiles(t, testGroups, testUsers)
+
+	tests := []struct {
+		args   []string
+		status int
+		out    string
+	}{
+		{[]string{"check", files[0], files[1], "ammar", "projects.webserver.build"}, exitOK, "allowed\n"},
+		{[]string{"check", files[0], files[1], "ammar", "projects.webserver.chat.moderate"}, exitFailed, "denied\n"},
+		{[]string{"check", "-json", files[0], files[1], "bob", "analytics.view"}, exitOK, `{"user":"bob","node":"analytics.view","allowed":true}` + "\n"},
+		{[]string{"check", files[0], "ammar"}, exitError, ""},
+		{[]string{"check", files[0], files[1], "ammar", "bad node"}, exitError, ""},
+		{[]string{"who-has", files[0], files[1], "analytics.view"}, exitOK, "ammar\nbob\n"},
+		{[]string{"who-has", "-json", files[0], files[1], "projects.x"}, exitOK, `["ammar"]` + "\n"},
+		{[]string{"explain", files[0], files[1], "ammar", "projects.webserver.chat.moderate"}, exitFailed, "ammar denied projects.webserver.chat.moderate: negated by user\n   user: -projects.*.chat.moderate\n"},
+		{[]string{"effective", files[0], files[1], "bob"}, exitOK, "analytics.*\n"},
+		{[]string{"nope"}, exitError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			status, out := runArgs(t, tt.args...)
+			if status != tt.status {
+				t.Errorf("status = %v, want %v", status, tt.status)
+			}
+			if out != tt.out {
+				t.Errorf("output = %q, want %q", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestExplain_JSON(t *testing.T) {
+	files := writeFiles(t, testGroups, testUsers)
+
+	status, out := runArgs(t, "explain", "-json", files[0], files[1], "ammar", "projects.webserver.build")
+	if status != exitOK {
+		t.Fatalf("status = %v", status)
+	}
+
+	var explanation struct {
+		Allowed bool
+		Reason  string
+		Steps   []struct {
+			Group   string
+			Matched []string
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &explanation); err != nil {
+		t.Fatalf("output is not json: %v\n%s", err, out)
+	}
+	if !explanation.Allowed || explanation.Reason != "granted by group manager" || len(explanation.Steps[0].Matched) != 2 {
+		t.Errorf("explanation = %+v", explanation)
+	}
+}
+
+func TestLint(t *testing.T) {
+	registry := writeFiles(t, `{"permissions": [{"node": "projects.*.build"}, {"node": "analytics.view"}]}`)
+	files := writeFiles(t, testGroups, testUsers)
+
+	status, out := runArgs(t, "lint", "-registry", registry[0], files[0], files[1])
+	if status != exitFailed {
+		t.Fatalf("status = %v", status)
+	}
+	want := files[0] + `: $.groups.manager.nodes[1]: projects.webserver.build: covered by projects.* (redundant)` + "\n" +
+		files[1] + `: $.users.ammar.nodes[0]: -projects.*.chat.moderate matches no registered permission (unknown-node)` + "\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestLint_Merge(t *testing.T) {
+	files := writeFiles(t, testGroups, `{"groups": {"manager": {"nodes": ["-projects.secret.*"]}}}`)
+
+	if status, out := runArgs(t, "lint", files[0], files[1]); status != exitFailed || !strings.Contains(out, "(overwritten)") {
+		t.Errorf("replace = %v, %q", status, out)
+	}
+	if status, out := runArgs(t, "lint", "-merge", "append", files[0], files[1]); strings.Contains(out, "(overwritten)") {
+		t.Errorf("append = %v, %q", status, out)
+	}
+	if status, _ := runArgs(t, "lint", "-merge", "nope", files[0], files[1]); status != exitError {
+		t.Errorf("status = %v, want %v", status, exitError)
+	}
+}
+
+func TestFmtMerge(t *testing.T) {
+	files := writeFiles(t, testGroups, testUsers)
+
+	status, out := runArgs(t, "fmt", files[1])
+	want := `{
+    "groups": {},
+    "users": {
+        "ammar": {
+            "groups": [
+                "manager",
+                "project_lead"
+            ],
+            "nodes": [
+                "-projects.*.chat.moderate"
+            ]
+        },
+        "bob": {
+            "groups": [
+                "project_lead"
+            ],
+            "nodes": []
+        }
+    }
+}
+`
+	if status != exitOK || out != want {
+		t.Errorf("fmt = %v, %s", status, out)
+	}
+
+	if status, _ := runArgs(t, "fmt", "-w", files[1]); status != exitOK {
+		t.Errorf("fmt -w status = %v", status)
+	}
+	if byt, _ := ioutil.ReadFile(files[1]); string(byt) != want {
+		t.Errorf("fmt -w wrote %s", byt)
+	}
+
+	status, out = runArgs(t, "merge", "-json", files[0], files[1])
+	if status != exitOK {
+		t.Fatalf("merge status = %v", status)
+	}
+	var merged struct {
+		Groups map[string]interface{}
+		Users  map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(out), &merged); err != nil {
+		t.Fatalf("merge output is not json: %v", err)
+	}
+	if len(merged.Groups) != 2 || len(merged.Users) != 2 {
+		t.Errorf("merge = %s", out)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := `{"groups": {"project_lead": {"nodes": ["analytics.*"]}}, "users": {"bob": {"groups": ["project_lead"]}}}`
+	after := `{"groups": {"project_lead": {"nodes": ["analytics.*", "-analytics.export"]}}, "users": {"bob": {"groups": ["project_lead"]}}}`
+	files := writeFiles(t, before, after)
+
+	status, out := runArgs(t, "diff", "-probes", "analytics.view,analytics.export", files[0], files[1])
+	want := "changed group project_lead\n" +
+		"   + -analytics.export\n" +
+		"user bob\n" +
+		"   loses analytics.export\n"
+	if status != exitFailed || out != want {
+		t.Errorf("diff = %v, %q, want %q", status, out, want)
+	}
+
+	if status, out := runArgs(t, "diff", files[0], files[0]); status != exitOK || out != "" {
+		t.Errorf("diff of identical files = %v, %q", status, out)
+	}
+
+	//permissions granted by default are granted on both sides
+	registry := writeFiles(t, `{"permissions": [{"node": "profile.view", "default": true}]}`)
+	if status, out := runArgs(t, "diff", "-registry", registry[0], files[0], files[0]); status != exitOK || out != "" {
+		t.Errorf("diff of identical files with a registry = %v, %q", status, out)
+	}
+}
+
+func TestMergeStrategy(t *testing.T) {
+	files := writeFiles(t, testGroups, `{"groups": {"manager": {"nodes": ["-projects.secret.*"]}}}`, testUsers)
+
+	tests := []struct {
+		merge  string
+		status int
+	}{
+		{"replace", exitFailed},
+		{"append", exitFailed},
+		{"error", exitError},
+		{"nope", exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.merge, func(t *testing.T) {
+			status, _ := runArgs(t, "check", "-merge", tt.merge, files[0], files[1], files[2], "ammar", "projects.secret.build")
+			if status != tt.status {
+				t.Errorf("status = %v, want %v", status, tt.status)
+			}
+		})
+	}
+
+	//append keeps the grants of both files where replace loses them
+	if status, _ := runArgs(t, "check", "-merge", "append", files[0], files[1], files[2], "ammar", "projects.webserver.build"); status != exitOK {
+		t.Errorf("append status = %v, want %v", status, exitOK)
+	}
+	if status, _ := runArgs(t, "check", files[0], files[1], files[2], "ammar", "projects.webserver.build"); status != exitFailed {
+		t.Errorf("replace status = %v, want %v", status, exitFailed)
+	}
+
+	stderr := new(bytes.Buffer)
+	run([]string{"merge", "-merge", "error", files[0], files[1]}, new(bytes.Buffer), stderr)
+	want := "perms merge: group \"manager\" in " + files[1] + " is already declared in " + files[0] + ": declared more than once\n"
+	if stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr, want)
+	}
+}
+
+func TestFmt_Formats(t *testing.T) {
+	file := filepath.Join(filepath.Dir(writeFiles(t, "{}")[0]), "users.yaml")
+	if err := ioutil.WriteFile(file, []byte("# ops\nusers: {bob: {groups: [project_lead]}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out := runArgs(t, "fmt", file)
+	want := "groups: {}\nusers:\n    bob:\n        groups:\n            - project_lead\n"
+	if status != exitOK || out != want {
+		t.Errorf("fmt = %v, %q, want %q", status, out, want)
+	}
+
+	output := filepath.Join(filepath.Dir(file), "merged.toml")
+	if status, _ := runArgs(t, "merge", "-o", output, file); status != exitOK {
+		t.Fatalf("merge status = %v", status)
+	}
+	if status, out := runArgs(t, "check", output, "bob", "analytics.view"); status != exitFailed || out != "denied\n" {
+		t.Errorf("check of merged toml = %v, %q", status, out)
+	}
+}
+
+func TestFmt_DSL(t *testing.T) {
+	file := filepath.Join(filepath.Dir(writeFiles(t, "{}")[0]), "users.perms")
+	input := "# the search team\nuser bob   in project_lead,manager\n    # until the migration\n    + projects.search.*\n"
+	if err := ioutil.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out := runArgs(t, "fmt", file)
+	want := "# the search team\nuser bob in project_lead, manager\n  # until the migration\n  + projects.search.*\n"
+	if status != exitOK || out != want {
+		t.Errorf("fmt = %v, %q, want %q", status, out, want)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("user bob\n  + bad node\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr := new(bytes.Buffer)
+	run([]string{"fmt", file}, new(bytes.Buffer), stderr)
+	if !strings.Contains(stderr.String(), "line 2: invalid node") {
+		t.Errorf("stderr = %q", stderr)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	status, out := runArgs(t, "schema")
+	var schema map[string]interface{}
+	if status != exitOK || json.Unmarshal([]byte(out), &schema) != nil || schema["title"] != "PConf" {
+		t.Errorf("schema = %v, %s", status, out)
+	}
+}
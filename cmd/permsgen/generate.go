@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/stratexio/perms"
+)
+
+//identifier converts words into a Go identifier.
+//Characters which can't appear in an identifier separate words.
+func identifier(words []string, exported bool) string {
+	buf := new(bytes.Buffer)
+	for _, word := range words {
+		upper := exported || buf.Len() > 0
+		for _, r := range word {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				upper = true
+				continue
+			}
+			if upper {
+				r = unicode.ToUpper(r)
+			} else if buf.Len() == 0 {
+				r = unicode.ToLower(r)
+			}
+			upper = false
+			buf.WriteRune(r)
+		}
+	}
+
+	id := buf.String()
+	if id == "" || unicode.IsDigit([]rune(id)[0]) {
+		if exported {
+			id = "Perm" + id
+		} else {
+			id = "p" + id
+		}
+	}
+	if token.IsKeyword(id) {
+		id += "Param"
+	}
+	return id
+}
+
+//permissionName returns the identifier of p, ignoring its wildcards
+func permissionName(p perms.Permission) string {
+	words := make([]string, 0, len(p.Node.Parts))
+	for _, part := range p.Node.Parts {
+		if part != perms.WildcardSelector {
+			words = append(words, part)
+		}
+	}
+	name := identifier(words, true)
+	//Registry is the function returning the registry
+	if name == "Registry" {
+		name += "Permission"
+	}
+	return name
+}
+
+//paramNames returns the parameter names of p
+func paramNames(p perms.Permission) []string {
+	var names []string
+	for i, part := range p.Node.Parts {
+		if part != perms.WildcardSelector {
+			continue
+		}
+		name := fmt.Sprintf("p%v", len(names))
+		if len(p.Params) > len(names) {
+			name = p.Params[len(names)]
+		} else if i > 0 {
+			//name it after the namespace it follows
+			name = p.Node.Parts[i-1]
+		}
+		name = identifier([]string{name}, false)
+		//perms would shadow the package and predeclared identifiers such as string are used by the generated code
+		if name == "perms" || types.Universe.Lookup(name) != nil {
+			name += "Param"
+		}
+		names = append(names, name)
+	}
+
+	//disambiguate duplicates
+	seen := make(map[string]int, len(names))
+	for i, name := range names {
+		seen[name]++
+		if seen[name] > 1 {
+			names[i] = fmt.Sprintf("%v%v", name, seen[name])
+		}
+	}
+	return names
+}
+
+//comment returns a doc comment for the declaration name of p
+func comment(name string, p perms.Permission, params []string) string {
+	buf := new(bytes.Buffer)
+	if len(params) == 0 {
+		fmt.Fprintf(buf, "//%v is %v", name, p.Node)
+	} else {
+		fmt.Fprintf(buf, "//%v returns %v with its wildcards replaced by %v", name, p.Node, strings.Join(params, ", "))
+	}
+	if p.Description != "" {
+		fmt.Fprintf(buf, "\n//%v", strings.Replace(p.Description, "\n", "\n//", -1))
+	}
+	if p.Service != "" {
+		fmt.Fprintf(buf, "\n//Checked by %v", p.Service)
+	}
+	return buf.String()
+}
+
+//generate returns the source of a package declaring each permission in reg.
+//Permissions without wildcards become variables, the rest become functions taking their parameters.
+func generate(reg *perms.Registry, pkg string, source string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by permsgen from %v. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(buf, "package %v\n\n", pkg)
+	fmt.Fprintf(buf, "import \"github.com/stratexio/perms\"\n\n")
+
+	permissions := reg.Permissions()
+	declared := make(map[string]string, len(permissions))
+
+	for _, p := range permissions {
+		name := permissionName(p)
+		if other, exists := declared[name]; exists {
+			return nil, errors.Errorf("%v and %v would both be named %v", other, p.Node, name)
+		}
+		declared[name] = p.Node.String()
+
+		params := paramNames(p)
+		parts := make([]string, len(p.Node.Parts))
+		var param int
+		for i, part := range p.Node.Parts {
+			if part == perms.WildcardSelector {
+				parts[i] = params[param]
+				param++
+				continue
+			}
+			parts[i] = fmt.Sprintf("%q", part)
+		}
+
+		fmt.Fprintln(buf, comment(name, p, params))
+		if len(params) == 0 {
+			fmt.Fprintf(buf, "var %v = perms.Node{Parts: []string{%v}}\n\n", name, strings.Join(parts, ", "))
+			continue
+		}
+		fmt.Fprintf(buf, "func %v(%v string) perms.Node {\n", name, strings.Join(params, ", "))
+		fmt.Fprintf(buf, "\treturn perms.Node{Parts: []string{%v}}\n}\n\n", strings.Join(parts, ", "))
+	}
+
+	fmt.Fprintf(buf, "//Registry returns a registry of every permission in %v\n", source)
+	fmt.Fprintf(buf, "func Registry() *perms.Registry {\n\tr := perms.NewRegistry()\n\tr.MustRegister(\n")
+	for _, p := range permissions {
+		fmt.Fprintf(buf, "\t\tperms.Permission{\n\t\t\tNode: perms.MustParseNode(%q),\n", p.Node)
+		if len(p.Params) > 0 {
+			fmt.Fprintf(buf, "\t\t\tParams: %#v,\n", p.Params)
+		}
+		if p.Description != "" {
+			fmt.Fprintf(buf, "\t\t\tDescription: %q,\n", p.Description)
+		}
+		if p.Service != "" {
+			fmt.Fprintf(buf, "\t\t\tService: %q,\n", p.Service)
+		}
+		if p.Default {
+			fmt.Fprintf(buf, "\t\t\tDefault: true,\n")
+		}
+		fmt.Fprintf(buf, "\t\t},\n")
+	}
+	fmt.Fprintf(buf, "\t)\n\treturn r\n}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to format generated source")
+	}
+	return src, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/stratexio/perms"
+)
+
+func TestIdentifier(t *testing.T) {
+	tests := []struct {
+		words    []string
+		exported bool
+		want     string
+	}{
+		{[]string{"billing", "credit_cards", "view"}, true, "BillingCreditCardsView"},
+		{[]string{"2fa", "reset"}, true, "Perm2faReset"},
+		{[]string{"project-id"}, false, "projectId"},
+		{[]string{"Type"}, false, "typeParam"},
+	}
+	for _, tt := range tests {
+		if got := identifier(tt.words, tt.exported); got != tt.want {
+			t.Errorf("identifier(%v) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
+
+//typeCheck parses and type checks generated source
+func typeCheck(t *testing.T, src []byte) *ast.File {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "perms_gen.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := config.Check("permissions", fset, []*ast.File{file}, nil); err != nil {
+		t.Fatalf("generated source does not compile: %v\n%s", err, src)
+	}
+	return file
+}
+
+func TestGenerate(t *testing.T) {
+	reg := perms.MustParseRegistry([]byte(`{"permissions": [
+		{"node": "billing.credit_cards.view", "description": "View saved credit cards", "service": "billing"},
+		{"node": "projects.*.build", "params": ["project"], "description": "Build a project"},
+		{"node": "projects.*.chat.*", "default": true}
+	]}`))
+
+	src, err := generate(reg, "permissions", "perms.json")
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+
+	file := typeCheck(t, src)
+
+	decls := make(map[string]string)
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			var params []string
+			for _, field := range decl.Type.Params.List {
+				for _, name := range field.Names {
+					params = append(params, name.Name)
+				}
+			}
+			decls[decl.Name.Name] = "func(" + strings.Join(params, ", ") + ")"
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.ValueSpec); ok {
+					decls[spec.Names[0].Name] = "var"
+				}
+			}
+		}
+	}
+
+	want := map[string]string{
+		"BillingCreditCardsView": "var",
+		"ProjectsBuild":          "func(project)",
+		"ProjectsChat":           "func(projects, chat)",
+		"Registry":               "func()",
+	}
+	for name, kind := range want {
+		if decls[name] != kind {
+			t.Errorf("%v is declared as %q, want %q\n%s", name, decls[name], kind, src)
+		}
+	}
+
+	if !strings.Contains(string(src), `return perms.Node{Parts: []string{"projects", project, "build"}}`) {
+		t.Errorf("ProjectsBuild does not build its node\n%s", src)
+	}
+}
+
+func TestGenerate_Collision(t *testing.T) {
+	reg := perms.MustParseRegistry([]byte(`{"permissions": [
+		{"node": "projects.build"},
+		{"node": "projects.*.build"}
+	]}`))
+
+	if _, err := generate(reg, "permissions", "perms.json"); err == nil {
+		t.Errorf("generate() should fail when two permissions share a name")
+	}
+}
+
+func TestGenerate_Reserved(t *testing.T) {
+	reg := perms.MustParseRegistry([]byte(`{"permissions": [
+		{"node": "perms.*.edit"},
+		{"node": "registry"},
+		{"node": "settings.string.*"},
+		{"node": "len.*", "params": ["nil"]}
+	]}`))
+
+	src, err := generate(reg, "permissions", "perms.json")
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	typeCheck(t, src)
+	for _, want := range []string{
+		"func PermsEdit(permsParam string) perms.Node",
+		"var RegistryPermission = ",
+		"func SettingsString(stringParam string) perms.Node",
+		"func Len(nilParam string) perms.Node",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code lacks %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("generated code:\n%s", src)
+	}
+}
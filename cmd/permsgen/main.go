@@ -0,0 +1,59 @@
+//Command permsgen generates a Go package of permission nodes from a registry file.
+//
+//Misspelled permissions become compile errors instead of silently denied checks.
+//It is meant to be run by go generate:
+//
+//	//go:generate go run github.com/stratexio/perms/cmd/permsgen -in perms.json -out perms_gen.go
+//
+//Permissions without wildcards are declared as variables holding a parsed node.
+//Permissions with wildcards are declared as functions which take a string for each wildcard,
+//named after the permission's params.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stratexio/perms"
+)
+
+func main() {
+	in := flag.String("in", "perms.json", "registry file to read")
+	out := flag.String("out", "", "file to write, standard output if empty")
+	pkg := flag.String("pkg", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	flag.Parse()
+
+	if err := run(*in, *out, *pkg); err != nil {
+		fmt.Fprintf(os.Stderr, "permsgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in string, out string, pkg string) error {
+	if pkg == "" {
+		return fmt.Errorf("no package name, set -pkg or run with go generate")
+	}
+
+	byt, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	reg, err := perms.ParseRegistry(byt)
+	if err != nil {
+		return fmt.Errorf("%v: %v", in, err)
+	}
+
+	src, err := generate(reg, pkg, filepath.Base(in))
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
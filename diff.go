@@ -0,0 +1,321 @@
+package perms
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+//ChangeKind describes how a user or group changed
+type ChangeKind string
+
+//change kinds
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+//EntityDiff describes how a user or group changed between two webs
+type EntityDiff struct {
+	Name string     `json:"name"`
+	Kind ChangeKind `json:"kind"`
+	//AddedRefs and RemovedRefs are the parents of a group or the groups of a user
+	AddedRefs    []string `json:"added_refs,omitempty"`
+	RemovedRefs  []string `json:"removed_refs,omitempty"`
+	AddedNodes   []string `json:"added_nodes,omitempty"`
+	RemovedNodes []string `json:"removed_nodes,omitempty"`
+}
+
+//Impact describes how the permissions of a user changed between two webs
+type Impact struct {
+	User   string   `json:"user"`
+	Gained []string `json:"gained,omitempty"`
+	Lost   []string `json:"lost,omitempty"`
+}
+
+//WebDiff describes the differences between two webs
+type WebDiff struct {
+	Groups []EntityDiff `json:"groups"`
+	Users  []EntityDiff `json:"users"`
+	Impact []Impact     `json:"impact"`
+}
+
+//Empty checks if nothing changed
+func (d WebDiff) Empty() bool {
+	return len(d.Groups) == 0 && len(d.Users) == 0 && len(d.Impact) == 0
+}
+
+//String returns a human readable version of d
+func (d WebDiff) String() string {
+	buf := new(bytes.Buffer)
+	entities := func(kind string, diffs []EntityDiff, refs string) {
+		for _, e := range diffs {
+			fmt.Fprintf(buf, "%v %v %v\n", e.Kind, kind, e.Name)
+			for _, ref := range e.AddedRefs {
+				fmt.Fprintf(buf, "   + %v %v\n", refs, ref)
+			}
+			for _, ref := range e.RemovedRefs {
+				fmt.Fprintf(buf, "   - %v %v\n", refs, ref)
+			}
+			for _, n := range e.AddedNodes {
+				fmt.Fprintf(buf, "   + %v\n", n)
+			}
+			for _, n := range e.RemovedNodes {
+				fmt.Fprintf(buf, "   - %v\n", n)
+			}
+		}
+	}
+	entities("group", d.Groups, "parent")
+	entities("user", d.Users, "group")
+
+	for _, i := range d.Impact {
+		fmt.Fprintf(buf, "user %v\n", i.User)
+		for _, n := range i.Gained {
+			fmt.Fprintf(buf, "   gains %v\n", n)
+		}
+		for _, n := range i.Lost {
+			fmt.Fprintf(buf, "   loses %v\n", n)
+		}
+	}
+	return buf.String()
+}
+
+//difference returns the strings in a which are not in b, in order
+func difference(a []string, b []string) []string {
+	var out []string
+	for _, s := range a {
+		var found bool
+		for _, t := range b {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+//entity is the part of a user or group Diff compares.
+//refs are the parents of a group or the groups of a user.
+type entity struct {
+	refs  []string
+	nodes Nodes
+}
+
+//diffEntity compares a user or group. A nil entity doesn't exist.
+//ok is false if nothing changed.
+func diffEntity(name string, before *entity, after *entity) (e EntityDiff, ok bool) {
+	e.Name = name
+	switch {
+	case before == nil:
+		e.Kind = Added
+		before = &entity{}
+	case after == nil:
+		e.Kind = Removed
+		after = &entity{}
+	default:
+		e.Kind = Changed
+	}
+
+	e.AddedRefs = difference(after.refs, before.refs)
+	e.RemovedRefs = difference(before.refs, after.refs)
+	e.AddedNodes = difference(after.nodes.Strings(), before.nodes.Strings())
+	e.RemovedNodes = difference(before.nodes.Strings(), after.nodes.Strings())
+
+	if e.Kind == Changed && len(e.AddedRefs)+len(e.RemovedRefs)+len(e.AddedNodes)+len(e.RemovedNodes) == 0 {
+		return e, false
+	}
+	return e, true
+}
+
+//mergeNames returns the sorted union of two sorted lists of names
+func mergeNames(a []string, b []string) []string {
+	out := make([]string, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			out, a = append(out, a[0]), a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			out, b = append(out, b[0]), b[1:]
+		default:
+			out, a, b = append(out, a[0]), a[1:], b[1:]
+		}
+	}
+	return out
+}
+
+//expandProbe returns the checks to perform for probe.
+//Each wildcard is replaced by every namespace named at its position by a node overlapping probe,
+//and by a namespace nobody names, which stands for every other value.
+func expandProbe(probe Node, nodes []Node) []Node {
+	overlapping := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		if _, ok := intersect(probe, n); ok {
+			overlapping = append(overlapping, n)
+		}
+	}
+
+	checks := []Node{{Parts: make([]string, 0, len(probe.Parts))}}
+	for i, part := range probe.Parts {
+		values := []string{part}
+		if part == WildcardSelector {
+			values = []string{freshPart}
+			seen := map[string]bool{freshPart: true}
+			for _, n := range overlapping {
+				if i < len(n.Parts) && n.Parts[i] != WildcardSelector && !seen[n.Parts[i]] {
+					seen[n.Parts[i]] = true
+					values = append(values, n.Parts[i])
+				}
+			}
+		}
+
+		next := make([]Node, 0, len(checks)*len(values))
+		for _, check := range checks {
+			for _, value := range values {
+				parts := make([]string, len(check.Parts), len(probe.Parts))
+				copy(parts, check.Parts)
+				next = append(next, Node{Parts: append(parts, value)})
+			}
+		}
+		checks = next
+	}
+	return checks
+}
+
+//probeString renders a check made by expandProbe, showing unnamed namespaces as wildcards
+func probeString(check Node) string {
+	parts := make([]string, len(check.Parts))
+	for i, part := range check.Parts {
+		parts[i] = part
+		if part == freshPart {
+			parts[i] = WildcardSelector
+		}
+	}
+	return Node{Parts: parts}.String()
+}
+
+//allNodes returns every node of every user and group in w
+func (w *Web) allNodes() []Node {
+	var nodes []Node
+	for _, g := range w.groups {
+		nodes = append(nodes, g.Nodes...)
+	}
+	w.loadUsers()
+	for _, u := range w.users {
+		nodes = append(nodes, u.Nodes...)
+	}
+	return nodes
+}
+
+//Diff compares before and after.
+//Impact is computed by checking probes for every user.
+//A wildcard in a probe stands for any value: it is checked with every value either web names
+//at its position, and gains or losses for unnamed values are reported with the wildcard.
+//Both webs are checked with the registry of after, or of before if after has none,
+//so permissions the registry grants by default are never reported as gained or lost because only one web has it.
+//If probes is nil, the permissions registered with that registry are used.
+//Probes are neither reported to the registry nor denied for being unregistered, whatever its mode.
+func Diff(before *Web, after *Web, probes Nodes) WebDiff {
+	d := WebDiff{Groups: []EntityDiff{}, Users: []EntityDiff{}, Impact: []Impact{}}
+
+	for _, name := range mergeNames(before.GroupNames(), after.GroupNames()) {
+		var b, a *entity
+		if g := before.groups[name]; g != nil {
+			b = &entity{refs: g.Parents, nodes: g.Nodes}
+		}
+		if g := after.groups[name]; g != nil {
+			a = &entity{refs: g.Parents, nodes: g.Nodes}
+		}
+		if e, ok := diffEntity(name, b, a); ok {
+			d.Groups = append(d.Groups, e)
+		}
+	}
+
+	users := mergeNames(before.UserNames(), after.UserNames())
+	for _, name := range users {
+		var b, a *entity
+		if u := before.users[name]; u != nil {
+			b = &entity{refs: u.Groups, nodes: u.Nodes}
+		}
+		if u := after.users[name]; u != nil {
+			a = &entity{refs: u.Groups, nodes: u.Nodes}
+		}
+		if e, ok := diffEntity(name, b, a); ok {
+			d.Users = append(d.Users, e)
+		}
+	}
+
+	registry := after.registry
+	if registry == nil {
+		registry = before.registry
+	}
+	if probes == nil {
+		if registry != nil {
+			for _, p := range registry.Permissions() {
+				probes = append(probes, p.Node)
+			}
+		}
+	}
+
+	nodes := append(before.allNodes(), after.allNodes()...)
+	var checks []Node
+	seen := make(map[string]bool)
+	for _, probe := range probes {
+		for _, check := range expandProbe(probe, nodes) {
+			if str := check.String(); !seen[str] {
+				seen[str] = true
+				checks = append(checks, check)
+			}
+		}
+	}
+
+	for _, name := range users {
+		impact := Impact{User: name}
+		for _, check := range checks {
+			had := before.probe(registry, name, check)
+			has := after.probe(registry, name, check)
+			switch {
+			case has && !had:
+				impact.Gained = append(impact.Gained, probeString(check))
+			case had && !has:
+				impact.Lost = append(impact.Lost, probeString(check))
+			}
+		}
+		sort.Strings(impact.Gained)
+		sort.Strings(impact.Lost)
+		if len(impact.Gained)+len(impact.Lost) > 0 {
+			d.Impact = append(d.Impact, impact)
+		}
+	}
+	return d
+}
+
+//probe checks if a user has a permission like CheckUserHasPermission, as if w had registry r, which may be nil.
+//Probes no one wrote are checked, so unregistered ones are neither reported to r nor denied.
+func (w *Web) probe(r *Registry, name string, check Node) bool {
+	check = w.norm.Node(check)
+	var perm Permission
+	if r != nil {
+		perm, _ = r.lookup(check, w.norm)
+	}
+	return w.checkUser(name, perm.Default, func(ns Nodes) (bool, bool) {
+		return ns.Check(check)
+	})
+}
+
+//DiffPConfs compares the webs assembled from two sets of PConfs
+func DiffPConfs(before []*PConf, after []*PConf, probes Nodes) (WebDiff, error) {
+	webs := [2]*Web{NewWeb(), NewWeb()}
+	for i, pconfs := range [][]*PConf{before, after} {
+		for _, pc := range pconfs {
+			if err := webs[i].AddPConf(pc); err != nil {
+				return WebDiff{}, err
+			}
+		}
+	}
+	return Diff(webs[0], webs[1], probes), nil
+}
@@ -0,0 +1,101 @@
+package perms
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before := testWeb()
+	after := testWeb()
+	after.AddGroup(&Group{Name: "manager", Nodes: MustParseNodes(strings.NewReader("projects.* -projects.secret.* -projects.payroll.*"))})
+	after.AddGroup(&Group{Name: "auditor", Nodes: MustParseNodes(strings.NewReader("analytics.view"))})
+	after.AddUser(&User{Name: "bob", Groups: []string{"project_lead", "manager"}})
+	after.AddUser(&User{Name: "carl", Groups: []string{"auditor"}})
+
+	d := Diff(before, after, MustParseNodes(strings.NewReader("projects.*.build analytics.view")))
+
+	wantGroups := []EntityDiff{
+		{Name: "auditor", Kind: Added, AddedNodes: []string{"analytics.view"}},
+		{Name: "manager", Kind: Changed, AddedNodes: []string{"-projects.payroll.*"}},
+	}
+	if !reflect.DeepEqual(d.Groups, wantGroups) {
+		t.Errorf("Groups = %+v, want %+v", d.Groups, wantGroups)
+	}
+	wantUsers := []EntityDiff{
+		{Name: "bob", Kind: Changed, AddedRefs: []string{"manager"}},
+		{Name: "carl", Kind: Added, AddedRefs: []string{"auditor"}},
+	}
+	if !reflect.DeepEqual(d.Users, wantUsers) {
+		t.Errorf("Users = %+v, want %+v", d.Users, wantUsers)
+	}
+	wantImpact := []Impact{
+		{User: "ammar", Lost: []string{"projects.payroll.build"}},
+		{User: "bob", Gained: []string{"projects.*.build"}},
+		{User: "carl", Gained: []string{"analytics.view"}},
+	}
+	if !reflect.DeepEqual(d.Impact, wantImpact) {
+		t.Errorf("Impact = %+v, want %+v", d.Impact, wantImpact)
+	}
+
+	if d := Diff(before, testWeb(), nil); !d.Empty() {
+		t.Errorf("Diff() of identical webs = %v, want empty", d)
+	}
+}
+
+func TestDiff_Registry(t *testing.T) {
+	before := testWeb()
+	after := testWeb()
+	after.AddUser(&User{Name: "bob", Groups: []string{"project_lead"}, Nodes: MustParseNodes(strings.NewReader("projects.*.view"))})
+
+	registry := NewRegistry()
+	registry.MustRegister(Permission{Node: MustParseNode("projects.*.view")}, Permission{Node: MustParseNode("profile.use")})
+	after.SetRegistry(registry)
+
+	d := Diff(before, after, nil)
+	want := []Impact{{User: "bob", Gained: []string{"projects.*.view", "projects.secret.view"}}}
+	if !reflect.DeepEqual(d.Impact, want) {
+		t.Errorf("Impact = %+v, want %+v", d.Impact, want)
+	}
+
+	wantString := "changed user bob\n" +
+		"   + projects.*.view\n" +
+		"user bob\n" +
+		"   gains projects.*.view\n" +
+		"   gains projects.secret.view\n"
+	if d.String() != wantString {
+		t.Errorf("String() = %q, want %q", d.String(), wantString)
+	}
+
+	//only after has the registry, but both sides are checked with it
+	registry.MustRegister(Permission{Node: MustParseNode("profile.view"), Default: true})
+	withRegistry := testWeb()
+	withRegistry.SetRegistry(registry)
+	if d := Diff(testWeb(), withRegistry, nil); !d.Empty() {
+		t.Errorf("Diff() of identical webs = %v, want empty", d)
+	}
+}
+
+func TestDiff_UnregisteredProbes(t *testing.T) {
+	before := testWeb()
+	after := testWeb()
+	after.AddUser(&User{Name: "bob", Groups: []string{"project_lead"}, Nodes: MustParseNodes(strings.NewReader("billing.view"))})
+
+	var reported Nodes
+	registry := NewRegistry()
+	registry.MustRegister(Permission{Node: MustParseNode("profile.use")})
+	registry.SetMode(UnknownError, func(check Node, err error) { reported = append(reported, check) })
+	before.SetRegistry(registry)
+	after.SetRegistry(registry)
+
+	//the probes are not registered, which must neither hide the change nor be reported
+	d := Diff(before, after, Nodes{MustParseNode("billing.*")})
+	want := []Impact{{User: "bob", Gained: []string{"billing.view"}}}
+	if !reflect.DeepEqual(d.Impact, want) {
+		t.Errorf("Impact = %+v, want %+v", d.Impact, want)
+	}
+	if len(reported) != 0 {
+		t.Errorf("Diff() reported %v to the registry", reported)
+	}
+}
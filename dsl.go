@@ -0,0 +1,315 @@
+package perms
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//SyntaxError is an error in a DSL file
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+//Error returns the message prefixed with the line number
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %v: %v", e.Line, e.Message)
+}
+
+//dsl declaration keywords
+const (
+	dslInclude  = "include"
+	dslGroup    = "group"
+	dslUser     = "user"
+	dslInherits = "inherits"
+	dslIn       = "in"
+)
+
+//dslNode is a node line and the comments above it
+type dslNode struct {
+	node     string
+	comments []string
+}
+
+//dslEntry is a declaration and the comments above it
+type dslEntry struct {
+	kind string
+	//name is the group or user name, or the included path
+	name     string
+	refs     []string
+	nodes    []dslNode
+	comments []string
+}
+
+//DSL is a parsed permissions DSL file.
+//It remembers the comments and order of the declarations so they can be kept by WriteDSL.
+//
+//	# comments take up a whole line
+//	include base.perms
+//
+//	group manager inherits project_lead
+//	  + projects.*
+//	  - projects.secret.*
+//
+//	user ammar in manager, project_lead
+//	  - projects.*.chat.moderate
+type DSL struct {
+	entries []dslEntry
+	//trailing holds the comments after the last declaration
+	trailing []string
+}
+
+//ParseDSL parses a permissions DSL file
+func ParseDSL(r io.Reader) (*DSL, error) {
+	d := &DSL{}
+	var comments []string
+	//declared holds the line each group and user is declared on
+	declared := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		fail := func(format string, args ...interface{}) error {
+			return &SyntaxError{Line: lineNo, Message: fmt.Sprintf(format, args...)}
+		}
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			comments = append(comments, line)
+			continue
+		case line[0] == '+' || line[0] == '-':
+			if len(d.entries) == 0 || d.entries[len(d.entries)-1].kind == dslInclude {
+				return nil, fail("node %q is not below a group or user", line)
+			}
+			raw := strings.TrimSpace(line[1:])
+			if raw == "" || raw[0] == '-' {
+				return nil, fail("expected a node after %q", line[:1])
+			}
+			if line[0] == '-' {
+				raw = string(NegateSignifier) + raw
+			}
+			if _, err := ParseNode(raw); err != nil {
+				return nil, fail("invalid node %q: %v", raw, err)
+			}
+			entry := &d.entries[len(d.entries)-1]
+			entry.nodes = append(entry.nodes, dslNode{node: raw, comments: comments})
+			comments = nil
+			continue
+		}
+
+		fields := strings.Fields(line)
+		entry := dslEntry{kind: fields[0], comments: comments}
+		comments = nil
+		switch entry.kind {
+		case dslInclude:
+			if len(fields) != 2 {
+				return nil, fail("expected include <path>")
+			}
+			entry.name = fields[1]
+		case dslGroup, dslUser:
+			keyword := dslInherits
+			if entry.kind == dslUser {
+				keyword = dslIn
+			}
+			if len(fields) < 2 {
+				return nil, fail("expected %v <name>", entry.kind)
+			}
+			entry.name = fields[1]
+			if len(fields) > 2 {
+				if fields[2] != keyword || len(fields) == 3 {
+					return nil, fail("expected %v <name> %v <names>", entry.kind, keyword)
+				}
+				for _, ref := range strings.Split(strings.Join(fields[3:], " "), ",") {
+					ref = strings.TrimSpace(ref)
+					if ref == "" || strings.ContainsAny(ref, " \t") {
+						return nil, fail("expected names separated by commas after %v", keyword)
+					}
+					entry.refs = append(entry.refs, ref)
+				}
+			}
+			key := entry.kind + " " + entry.name
+			if previous, ok := declared[key]; ok {
+				return nil, fail("%v %v is already declared on line %v", entry.kind, entry.name, previous)
+			}
+			declared[key] = lineNo
+		default:
+			return nil, fail("unknown declaration %q", fields[0])
+		}
+		d.entries = append(d.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	d.trailing = comments
+	return d, nil
+}
+
+//PConf returns the pconf d declares
+func (d *DSL) PConf() *PConf {
+	pc := newPConf()
+	for _, e := range d.entries {
+		var nodes []string
+		for _, n := range e.nodes {
+			nodes = append(nodes, n.node)
+		}
+		switch e.kind {
+		case dslInclude:
+			pc.Include = append(pc.Include, e.name)
+		case dslGroup:
+			pc.Groups[e.name] = pconfGroup{Parents: e.refs, Nodes: nodes}
+		case dslUser:
+			pc.Users[e.name] = pconfUser{Groups: e.refs, Nodes: nodes}
+		}
+	}
+	return pc
+}
+
+//dslName checks if name can be written in the dsl
+func dslName(kind string, name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n,#") {
+		return errors.Errorf("%v %q can not be written in the dsl", kind, name)
+	}
+	return nil
+}
+
+//WriteDSL writes pc in the permissions DSL.
+//If layout is not nil, the declarations and nodes it contains keep their comments and order,
+//so a file can be parsed, changed through a Web and written back without losing them.
+//Everything else is written after them, groups before users, in order.
+func WriteDSL(w io.Writer, pc *PConf, layout *DSL) error {
+	buf := new(bytes.Buffer)
+	comments := func(indent string, lines []string) {
+		for _, c := range lines {
+			fmt.Fprintf(buf, "%v%v\n", indent, c)
+		}
+	}
+	//block writes a group or user followed by a blank line
+	block := func(e dslEntry, refs []string, nodes []string) error {
+		if err := dslName(e.kind, e.name); err != nil {
+			return err
+		}
+		comments("", e.comments)
+		buf.WriteString(e.kind + " " + e.name)
+		if len(refs) > 0 {
+			for _, ref := range refs {
+				if err := dslName(e.kind, ref); err != nil {
+					return err
+				}
+			}
+			keyword := dslInherits
+			if e.kind == dslUser {
+				keyword = dslIn
+			}
+			fmt.Fprintf(buf, " %v %v", keyword, strings.Join(refs, ", "))
+		}
+		buf.WriteString("\n")
+
+		//nodes keep the comments of the first identical node in the layout
+		remaining := append([]dslNode{}, e.nodes...)
+		for _, n := range nodes {
+			for i, old := range remaining {
+				if old.node == n {
+					comments("  ", old.comments)
+					remaining = append(remaining[:i], remaining[i+1:]...)
+					break
+				}
+			}
+			if n != "" && n[0] == NegateSignifier {
+				fmt.Fprintf(buf, "  - %v\n", n[1:])
+			} else {
+				fmt.Fprintf(buf, "  + %v\n", n)
+			}
+		}
+		buf.WriteString("\n")
+		return nil
+	}
+
+	var entries []dslEntry
+	if layout != nil {
+		entries = layout.entries
+	}
+
+	//includes come first
+	included := make(map[string]bool, len(pc.Include))
+	for _, e := range entries {
+		if e.kind == dslInclude && contains(pc.Include, e.name) && !included[e.name] {
+			included[e.name] = true
+			comments("", e.comments)
+			fmt.Fprintf(buf, "%v %v\n", dslInclude, e.name)
+		}
+	}
+	for _, include := range pc.Include {
+		if strings.ContainsAny(include, " \t\r\n") {
+			return errors.Errorf("include %q can not be written in the dsl", include)
+		}
+		if !included[include] {
+			included[include] = true
+			fmt.Fprintf(buf, "%v %v\n", dslInclude, include)
+		}
+	}
+	if len(included) > 0 {
+		buf.WriteString("\n")
+	}
+
+	written := make(map[string]bool)
+	for _, e := range entries {
+		var err error
+		switch e.kind {
+		case dslGroup:
+			if g, ok := pc.Groups[e.name]; ok {
+				written[dslGroup+" "+e.name] = true
+				err = block(e, g.Parents, g.Nodes)
+			}
+		case dslUser:
+			if u, ok := pc.Users[e.name]; ok {
+				written[dslUser+" "+e.name] = true
+				err = block(e, u.Groups, u.Nodes)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range pc.groupNames() {
+		if !written[dslGroup+" "+name] {
+			g := pc.Groups[name]
+			if err := block(dslEntry{kind: dslGroup, name: name}, g.Parents, g.Nodes); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range pc.userNames() {
+		if !written[dslUser+" "+name] {
+			u := pc.Users[name]
+			if err := block(dslEntry{kind: dslUser, name: name}, u.Groups, u.Nodes); err != nil {
+				return err
+			}
+		}
+	}
+
+	if layout != nil && len(layout.trailing) > 0 {
+		comments("", layout.trailing)
+	} else if buf.Len() > 0 {
+		//drop the blank line after the last block
+		buf.Truncate(buf.Len() - 1)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+//contains checks if list contains s
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
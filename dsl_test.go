@@ -0,0 +1,127 @@
+package perms
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const formatDSL = `# shared with every environment
+include base.json
+
+# leads see analytics
+group project_lead
+  + analytics.*
+
+group manager inherits project_lead
+  + projects.*
+  # nobody but the owners
+  - projects.secret.*
+
+group auditors.eu
+
+user ammar in manager
+  - projects.*.chat.moderate
+
+# reviewed by security
+`
+
+func TestParseDSL(t *testing.T) {
+	d, err := ParseDSL(strings.NewReader(formatDSL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := MustParsePConf([]byte(formatJSON)); !reflect.DeepEqual(d.PConf(), want) {
+		t.Errorf("PConf() = %+v, want %+v", d.PConf(), want)
+	}
+
+	//formatting a parsed file changes nothing
+	buf := new(bytes.Buffer)
+	if err := WriteDSL(buf, d.PConf(), d); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != formatDSL {
+		t.Errorf("WriteDSL() = %s, want %s", buf, formatDSL)
+	}
+}
+
+func TestWriteDSL_Layout(t *testing.T) {
+	d, err := ParseDSL(strings.NewReader(formatDSL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := NewWeb()
+	web.AddPConf(d.PConf())
+	web.GetGroup("manager").Nodes = append(web.GetGroup("manager").Nodes, MustParseNode("-projects.payroll.*"))
+	web.DelGroup("project_lead")
+	web.AddUser(&User{Name: "bob", Groups: []string{"manager"}})
+
+	buf := new(bytes.Buffer)
+	if err := WriteDSL(buf, web.MasterPConf(), d); err != nil {
+		t.Fatal(err)
+	}
+	want := `group manager inherits project_lead
+  + projects.*
+  # nobody but the owners
+  - projects.secret.*
+  - projects.payroll.*
+
+group auditors.eu
+
+user ammar in manager
+  - projects.*.chat.moderate
+
+user bob in manager
+
+# reviewed by security
+`
+	if buf.String() != want {
+		t.Errorf("WriteDSL() = %s, want %s", buf, want)
+	}
+
+	buf.Reset()
+	if err := WriteDSL(buf, web.MasterPConf(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "group auditors.eu\n\ngroup manager") || strings.HasSuffix(buf.String(), "\n\n") {
+		t.Errorf("WriteDSL() without a layout = %s", buf)
+	}
+
+	web.AddUser(&User{Name: "carl", Groups: []string{"a, b"}})
+	if err := WriteDSL(buf, web.MasterPConf(), nil); err == nil {
+		t.Errorf("WriteDSL() wrote a group containing a comma")
+	}
+}
+
+func TestParseDSL_Errors(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+	}{
+		{"+ projects.*", 1},
+		{"group a\n  + projects.*\n\n  + bad node", 4},
+		{"group a\n  + -projects.*", 2},
+		{"group a\n  - ", 2},
+		{"group a extends b", 1},
+		{"user a in", 1},
+		{"user a in b,, c", 1},
+		{"include a.json\n  + x", 2},
+		{"group a\ngroup b\ngroup a", 3},
+		{"role a", 1},
+	}
+	for _, tt := range tests {
+		_, err := ParseDSL(strings.NewReader(tt.input))
+		syntaxErr, ok := errors.Cause(err).(*SyntaxError)
+		if !ok || syntaxErr.Line != tt.line {
+			t.Errorf("ParseDSL(%q) = %v, want an error on line %v", tt.input, err, tt.line)
+		}
+	}
+
+	_, err := ParseDSL(strings.NewReader("group a\ngroup a"))
+	if want := "line 2: group a is already declared on line 1"; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,202 @@
+package perms
+
+import (
+	"fmt"
+	"sync"
+)
+
+//EventType is the kind of change an Event describes
+type EventType int
+
+//event types
+const (
+	//UserAdded is published when a user is created
+	UserAdded EventType = iota
+	//UserRemoved is published when a user is deleted
+	UserRemoved
+	//UserNodesChanged is published when the nodes of a user change
+	UserNodesChanged
+	//MembershipChanged is published when a user joins or leaves groups
+	MembershipChanged
+	//GroupAdded is published when a group is created
+	GroupAdded
+	//GroupRemoved is published when a group is deleted
+	GroupRemoved
+	//GroupNodesChanged is published when the nodes of a group change
+	GroupNodesChanged
+	//GroupParentsChanged is published when the parents of a group change
+	GroupParentsChanged
+	//ConfigReloaded is published when many users and groups may have changed at once,
+	//by AddPConf, Reset, Rollback, SetStore or SetNormalization
+	ConfigReloaded
+	//BatchApplied is published when Update changes users and groups at once.
+	//Batch holds the events describing each change.
+	BatchApplied
+)
+
+//String returns the name of t
+func (t EventType) String() string {
+	switch t {
+	case UserAdded:
+		return "user added"
+	case UserRemoved:
+		return "user removed"
+	case UserNodesChanged:
+		return "user nodes changed"
+	case MembershipChanged:
+		return "membership changed"
+	case GroupAdded:
+		return "group added"
+	case GroupRemoved:
+		return "group removed"
+	case GroupNodesChanged:
+		return "group nodes changed"
+	case GroupParentsChanged:
+		return "group parents changed"
+	case ConfigReloaded:
+		return "config reloaded"
+	case BatchApplied:
+		return "batch applied"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+//Event describes a change to a Web
+type Event struct {
+	Type EventType
+	//Name is the user or group changed. It is empty for ConfigReloaded.
+	Name string
+	//Added and Removed hold the nodes, groups or parents which changed
+	Added   []string
+	Removed []string
+	//Batch holds the changes made by Update for BatchApplied
+	Batch []Event
+}
+
+//subscriber is a listener registered with Subscribe
+type subscriber struct {
+	id       int
+	listener func(Event)
+}
+
+//subscribers holds the listeners of a Web
+type subscribers struct {
+	mu   sync.Mutex
+	next int
+	list []subscriber
+}
+
+//Subscribe calls listener with every change to w, in order, once the change is visible to checks.
+//Listeners are called by the goroutine making the change and must not change w.
+//The returned function unsubscribes listener.
+func (w *Web) Subscribe(listener func(Event)) (unsubscribe func()) {
+	w.subs.mu.Lock()
+	defer w.subs.mu.Unlock()
+	id := w.subs.next
+	w.subs.next++
+	w.subs.list = append(w.subs.list, subscriber{id: id, listener: listener})
+	return func() {
+		w.subs.mu.Lock()
+		defer w.subs.mu.Unlock()
+		for i, s := range w.subs.list {
+			if s.id == id {
+				w.subs.list = append(w.subs.list[:i:i], w.subs.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+//SubscribeChan sends every change to w to ch, see Subscribe.
+//Changes to w block until ch receives them, so ch should be buffered and drained promptly.
+func (w *Web) SubscribeChan(ch chan<- Event) (unsubscribe func()) {
+	return w.Subscribe(func(e Event) {
+		ch <- e
+	})
+}
+
+//subscribed checks if w has any listeners
+func (w *Web) subscribed() bool {
+	w.subs.mu.Lock()
+	defer w.subs.mu.Unlock()
+	return len(w.subs.list) > 0
+}
+
+//tracking checks if changes to w need to be described by audit events
+func (w *Web) tracking() bool {
+	return w.audit != nil || w.feed != nil || w.subscribed()
+}
+
+//publish calls every listener of w with events
+func (w *Web) publish(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	w.subs.mu.Lock()
+	list := append([]subscriber{}, w.subs.list...)
+	w.subs.mu.Unlock()
+	for _, e := range events {
+		for _, s := range list {
+			s.listener(e)
+		}
+	}
+}
+
+//changeEvents returns the events describing changes.
+//Changes made by AddPConf, Reset and Rollback are described by one ConfigReloaded event
+//and changes made by Update by one BatchApplied event.
+func changeEvents(changes []AuditEvent) []Event {
+	var events []Event
+	for _, c := range changes {
+		switch c.Action {
+		case AuditAddPConf, AuditReset, AuditRollback:
+			return []Event{{Type: ConfigReloaded}}
+		}
+		events = append(events, entityEvents(c)...)
+	}
+	if len(changes) > 0 && changes[0].Action == AuditUpdate {
+		return []Event{{Type: BatchApplied, Batch: events}}
+	}
+	return events
+}
+
+//entityEvents returns the events describing the change to one user or group
+func entityEvents(c AuditEvent) []Event {
+	added, removed, changed := UserAdded, UserRemoved, UserNodesChanged
+	refsChanged := MembershipChanged
+	var beforeRefs, afterRefs []string
+	if c.Before != nil {
+		beforeRefs = c.Before.Groups
+	}
+	if c.After != nil {
+		afterRefs = c.After.Groups
+	}
+	if c.Kind == "group" {
+		added, removed, changed = GroupAdded, GroupRemoved, GroupNodesChanged
+		refsChanged = GroupParentsChanged
+		if c.Before != nil {
+			beforeRefs = c.Before.Parents
+		}
+		if c.After != nil {
+			afterRefs = c.After.Parents
+		}
+	}
+
+	var events []Event
+	switch {
+	case c.Before == nil && c.After == nil:
+	case c.Before == nil:
+		events = append(events, Event{Type: added, Name: c.Name})
+	case c.After == nil:
+		events = append(events, Event{Type: removed, Name: c.Name})
+	default:
+		//order is not a change
+		if joined, left := difference(afterRefs, beforeRefs), difference(beforeRefs, afterRefs); joined != nil || left != nil {
+			events = append(events, Event{Type: refsChanged, Name: c.Name, Added: joined, Removed: left})
+		}
+		if granted, revoked := difference(c.After.Nodes, c.Before.Nodes), difference(c.Before.Nodes, c.After.Nodes); granted != nil || revoked != nil {
+			events = append(events, Event{Type: changed, Name: c.Name, Added: granted, Removed: revoked})
+		}
+	}
+	return events
+}
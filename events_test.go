@@ -0,0 +1,63 @@
+package perms
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWeb_Subscribe(t *testing.T) {
+	web := testWeb()
+	var events []Event
+	unsubscribe := web.Subscribe(func(e Event) {
+		//the change is visible by the time it is published
+		if e.Type == MembershipChanged && !web.CheckUserHasPermission(e.Name, MustParseNode("projects.webserver.build")) {
+			t.Errorf("%v was published before it was made", e.Type)
+		}
+		events = append(events, e)
+	})
+
+	web.AddUser(&User{Name: "bob", Groups: []string{"manager"}})
+	web.AddGroup(&Group{Name: "manager", Parents: []string{"project_lead"}, Nodes: MustParseNodes(strings.NewReader("projects.* -projects.payroll.*"))})
+	web.AddUser(&User{Name: "carl"})
+	web.DelUser("carl")
+	web.DelUser("nobody")
+	web.AddPConf(MustParsePConf([]byte(`{"users": {"dan": {}}}`)))
+
+	want := []Event{
+		{Type: MembershipChanged, Name: "bob", Added: []string{"manager"}, Removed: []string{"project_lead"}},
+		{Type: GroupParentsChanged, Name: "manager", Added: []string{"project_lead"}},
+		{Type: GroupNodesChanged, Name: "manager", Added: []string{"-projects.payroll.*"}, Removed: []string{"-projects.secret.*"}},
+		{Type: UserAdded, Name: "carl"},
+		{Type: UserRemoved, Name: "carl"},
+		{Type: ConfigReloaded},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+
+	events = nil
+	web.SetNormalization(Normalization{FoldCase: true})
+	web.SetStore(NewMemoryStore())
+	if want := []Event{{Type: ConfigReloaded}, {Type: ConfigReloaded}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+
+	unsubscribe()
+	events = nil
+	web.AddUser(&User{Name: "carl"})
+	if len(events) != 0 {
+		t.Errorf("published %+v after unsubscribing", events)
+	}
+}
+
+func TestWeb_SubscribeChan(t *testing.T) {
+	web := NewWeb()
+	ch := make(chan Event, 1)
+	defer web.SubscribeChan(ch)()
+
+	web.AddGroup(&Group{Name: "manager"})
+	if e := <-ch; e.Type != GroupAdded || e.Name != "manager" {
+		t.Errorf("received %+v", e)
+	}
+}
@@ -0,0 +1,169 @@
+package perms
+
+import (
+	"bytes"
+	"fmt"
+)
+
+//Step is a layer of a user's permissions considered by a check
+type Step struct {
+	//Group is the name of the group, or empty for the user's own nodes
+	Group string `json:"group,omitempty"`
+	//Matched are the nodes of the layer which match the check
+	Matched Nodes `json:"matched"`
+	Negated bool  `json:"negated"`
+}
+
+//Explanation describes how a check was decided
+type Explanation struct {
+	User    string `json:"user"`
+	Node    Node   `json:"node"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	//Steps are the layers which matched the check in the order they were considered
+	Steps []Step `json:"steps"`
+}
+
+//String returns a human readable version of e
+func (e Explanation) String() string {
+	buf := new(bytes.Buffer)
+	verdict := "denied"
+	if e.Allowed {
+		verdict = "allowed"
+	}
+	fmt.Fprintf(buf, "%v %v %v: %v\n", e.User, verdict, e.Node, e.Reason)
+	for _, step := range e.Steps {
+		source := "user"
+		if step.Group != "" {
+			source = "group " + step.Group
+		}
+		for _, n := range step.Matched {
+			fmt.Fprintf(buf, "   %v: %v\n", source, n)
+		}
+	}
+	return buf.String()
+}
+
+//Effective contains the permissions of a user reduced to two layers.
+//A node is granted if User grants it, or if Groups grant it and User doesn't negate it.
+type Effective struct {
+	//User are the user's own nodes
+	User Nodes
+	//Groups are the nodes of the default group and the user's groups combined
+	Groups Nodes
+}
+
+//Check checks if e grants check
+func (e Effective) Check(check Node) bool {
+	if matched, negated := e.User.Check(check); matched {
+		return !negated
+	}
+	matched, negated := e.Groups.Check(check)
+	return matched && !negated
+}
+
+//Nodes combines the layers of e into a single list.
+//ErrUnrepresentable is returned if the user grants part of a node negated by its groups.
+func (e Effective) Nodes() (Nodes, error) {
+	grants, negations := e.User.split()
+	combined, err := Nodes(grants).Union(e.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	denied := make(Nodes, len(negations))
+	for i, n := range negations {
+		denied[i] = Node{Parts: n.Parts}
+	}
+	combined, err = combined.Subtract(denied)
+	if err != nil {
+		return nil, err
+	}
+
+	combined, _ = combined.Simplify()
+	return combined, nil
+}
+
+//matching returns the nodes of ns which match check and if any of them is a negation
+func (ns Nodes) matching(check Node) (matched Nodes, negated bool) {
+	for _, n := range ns {
+		if n.Match(check) {
+			matched = append(matched, n)
+			negated = negated || n.Negate
+		}
+	}
+	return matched, negated
+}
+
+//Explain checks if a user has a permission like CheckUserHasPermission
+//and describes which nodes decided it.
+//Unregistered checks are not reported to the registry.
+func (w *Web) Explain(name string, check Node) Explanation {
+	check = w.norm.Node(check)
+	e := Explanation{User: name, Node: check, Steps: []Step{}}
+
+	var perm Permission
+	if w.registry != nil {
+		var known bool
+		perm, known = w.registry.lookup(check, w.norm)
+		if !known && w.registry.denies() {
+			e.Reason = "node is not registered"
+			return e
+		}
+	}
+
+	user := w.user(w.norm.Normalize(name))
+	if user == nil {
+		e.Reason = "user does not exist"
+		return e
+	}
+
+	matched, negated := user.Nodes.matching(check)
+	if len(matched) > 0 {
+		e.Steps = append(e.Steps, Step{Matched: matched, Negated: negated})
+		e.Allowed = !negated
+		if negated {
+			e.Reason = "negated by user"
+		} else {
+			e.Reason = "granted by user"
+		}
+		return e
+	}
+
+	groups := make([]string, 0, len(user.Groups)+1)
+	if _, exists := w.groups["default"]; exists {
+		groups = append(groups, "default")
+	}
+	groups = append(groups, user.Groups...)
+
+	for _, groupName := range groups {
+		group := w.groups[groupName]
+		if group == nil {
+			continue
+		}
+		matched, negated := group.Nodes.matching(check)
+		if len(matched) == 0 {
+			continue
+		}
+		e.Steps = append(e.Steps, Step{Group: groupName, Matched: matched, Negated: negated})
+		if negated {
+			e.Allowed = false
+			e.Reason = "negated by group " + groupName
+			return e
+		}
+		if !e.Allowed {
+			e.Allowed = true
+			e.Reason = "granted by group " + groupName
+		}
+	}
+
+	if !e.Allowed {
+		if perm.Default {
+			e.Allowed = true
+			e.Reason = "granted by default"
+		} else {
+			e.Reason = "not granted"
+		}
+	}
+	return e
+}
@@ -0,0 +1,59 @@
+package perms
+
+import (
+	"strings"
+	"testing"
+)
+
+func testWeb() *Web {
+	web := NewWeb()
+	web.AddGroup(&Group{Name: "default", Nodes: MustParseNodes(strings.NewReader("profile.use"))})
+	web.AddGroup(&Group{Name: "project_lead", Nodes: MustParseNodes(strings.NewReader("analytics.*"))})
+	web.AddGroup(&Group{Name: "manager", Nodes: MustParseNodes(strings.NewReader("projects.* -projects.secret.*"))})
+	web.AddUser(&User{
+		Name:   "ammar",
+		Groups: []string{"project_lead", "manager"},
+		Nodes:  MustParseNodes(strings.NewReader("-projects.*.chat.moderate projects.secret.build")),
+	})
+	web.AddUser(&User{Name: "bob", Groups: []string{"project_lead"}})
+	return web
+}
+
+func TestWeb_Explain(t *testing.T) {
+	web := testWeb()
+
+	tests := []struct {
+		user    string
+		check   string
+		allowed bool
+		reason  string
+	}{
+		{"ammar", "projects.webserver.chat.moderate", false, "negated by user"},
+		{"ammar", "projects.secret.build", true, "granted by user"},
+		{"ammar", "projects.secret.view", false, "negated by group manager"},
+		{"ammar", "projects.webserver.build", true, "granted by group manager"},
+		{"ammar", "profile.use", true, "granted by group default"},
+		{"bob", "projects.webserver.build", false, "not granted"},
+		{"carl", "profile.use", false, "user does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.check, func(t *testing.T) {
+			check := MustParseNode(tt.check)
+			e := web.Explain(tt.user, check)
+			if e.Allowed != tt.allowed || e.Reason != tt.reason {
+				t.Errorf("Explain() = %v, %q, want %v, %q", e.Allowed, e.Reason, tt.allowed, tt.reason)
+			}
+			if e.Allowed != web.CheckUserHasPermission(tt.user, check) {
+				t.Errorf("Explain() disagrees with CheckUserHasPermission()")
+			}
+		})
+	}
+
+	e := web.Explain("ammar", MustParseNode("projects.secret.view"))
+	want := "ammar denied projects.secret.view: negated by group manager\n" +
+		"   group manager: projects.*\n" +
+		"   group manager: -projects.secret.*\n"
+	if e.String() != want {
+		t.Errorf("String() = %q, want %q", e.String(), want)
+	}
+}
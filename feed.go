@@ -0,0 +1,273 @@
+package perms
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//ErrFeedGap is returned when a feed no longer holds the changes following a sequence number
+var ErrFeedGap = errors.New("changes are no longer available")
+
+//Change is an entry of a Feed describing one change to a Web
+type Change struct {
+	//Seq increases by one with every change
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	//Snapshot replaces every user and group if it is set
+	Snapshot *PConf `json:"snapshot,omitempty"`
+	//Groups and Users hold the state of each group and user changed, nil if it was deleted
+	Groups map[string]*AuditEntity `json:"groups,omitempty"`
+	Users  map[string]*AuditEntity `json:"users,omitempty"`
+}
+
+//Snapshot is the state of a Web after a change
+type Snapshot struct {
+	Seq   uint64 `json:"seq"`
+	PConf *PConf `json:"pconf"`
+}
+
+//FeedSource is where a Follower reads changes from, such as a Feed or a client of a remote one
+type FeedSource interface {
+	//Changes returns the changes following seq, oldest first.
+	//It returns ErrFeedGap if it no longer holds all of them.
+	Changes(seq uint64) ([]Change, error)
+	//Snapshot returns the state after the newest change
+	Snapshot() (Snapshot, error)
+}
+
+//Feed is an ordered log of the changes to a Web, see Web.SetFeed.
+//It is a FeedSource and is safe for concurrent use.
+type Feed struct {
+	mu      sync.Mutex
+	changes []Change
+	limit   int
+	seq     uint64
+	//groups and users hold the state after the newest change
+	groups map[string]*AuditEntity
+	users  map[string]*AuditEntity
+}
+
+//NewFeed returns an empty feed which keeps the newest limit changes.
+//A limit of 0 keeps every change.
+func NewFeed(limit int) *Feed {
+	return &Feed{limit: limit, groups: make(map[string]*AuditEntity), users: make(map[string]*AuditEntity)}
+}
+
+//feedChange returns the change described by events
+func feedChange(events []AuditEvent) Change {
+	c := Change{Groups: make(map[string]*AuditEntity), Users: make(map[string]*AuditEntity)}
+	for _, e := range events {
+		if e.Kind == "group" {
+			c.Groups[e.Name] = e.After
+		} else {
+			c.Users[e.Name] = e.After
+		}
+	}
+	return c
+}
+
+//add numbers c and adds it to f
+func (f *Feed) add(c Change) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	c.Seq, c.Time = f.seq, time.Now()
+
+	if c.Snapshot != nil {
+		f.groups = make(map[string]*AuditEntity, len(c.Snapshot.Groups))
+		f.users = make(map[string]*AuditEntity, len(c.Snapshot.Users))
+		//the snapshot is copied so later changes to what it was made from cannot reach the feed
+		snapshot := newPConf()
+		for name, g := range c.Snapshot.Groups {
+			g = pconfGroup{Parents: append([]string{}, g.Parents...), Nodes: append([]string{}, g.Nodes...)}
+			snapshot.Groups[name] = g
+			f.groups[name] = &AuditEntity{Parents: g.Parents, Nodes: g.Nodes}
+		}
+		for name, u := range c.Snapshot.Users {
+			u = pconfUser{Groups: append([]string{}, u.Groups...), Nodes: append([]string{}, u.Nodes...)}
+			snapshot.Users[name] = u
+			f.users[name] = &AuditEntity{Groups: u.Groups, Nodes: u.Nodes}
+		}
+		c.Snapshot = snapshot
+	}
+	for name, g := range c.Groups {
+		if g == nil {
+			delete(f.groups, name)
+		} else {
+			f.groups[name] = g
+		}
+	}
+	for name, u := range c.Users {
+		if u == nil {
+			delete(f.users, name)
+		} else {
+			f.users[name] = u
+		}
+	}
+
+	f.changes = append(f.changes, c)
+	if f.limit > 0 && len(f.changes) > f.limit {
+		f.changes = append([]Change{}, f.changes[len(f.changes)-f.limit:]...)
+	}
+}
+
+//Seq returns the sequence number of the newest change, 0 if there is none
+func (f *Feed) Seq() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+//Changes returns the changes following seq, oldest first.
+//It returns ErrFeedGap if some of them are no longer kept, or if seq is newer than any change.
+//The changes must not be changed.
+func (f *Feed) Changes(seq uint64) ([]Change, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if seq > f.seq || (len(f.changes) > 0 && seq+1 < f.changes[0].Seq) || (len(f.changes) == 0 && seq < f.seq) {
+		return nil, errors.Wrapf(ErrFeedGap, "after %v", seq)
+	}
+	return append([]Change{}, f.changes[len(f.changes)-int(f.seq-seq):]...), nil
+}
+
+//Snapshot returns the state after the newest change, which shares nothing with f
+func (f *Feed) Snapshot() (Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pc := newPConf()
+	for name, g := range f.groups {
+		pc.Groups[name] = pconfGroup{Parents: append([]string{}, g.Parents...), Nodes: append([]string{}, g.Nodes...)}
+	}
+	for name, u := range f.users {
+		pc.Users[name] = pconfUser{Groups: append([]string{}, u.Groups...), Nodes: append([]string{}, u.Nodes...)}
+	}
+	return Snapshot{Seq: f.seq, PConf: pc}, nil
+}
+
+//Feed returns the feed of w, or nil if it has none
+func (w *Web) Feed() *Feed {
+	return w.feed
+}
+
+//SetFeed logs every change to w to f, starting with a snapshot of the current state of w.
+//Changes made by AddUser, DelUser, AddGroup, DelGroup, AddPConf, Reset, Rollback and Update
+//log the users and groups they change, and SetStore and SetNormalization log a snapshot.
+//A nil f stops logging.
+func (w *Web) SetFeed(f *Feed) {
+	w.feed = f
+	if f != nil {
+		f.add(Change{Snapshot: w.MasterPConf()})
+	}
+}
+
+//Follower keeps a Web up to date with the changes read from a FeedSource
+type Follower struct {
+	web    *Web
+	source FeedSource
+	seq    uint64
+}
+
+//NewFollower returns a follower applying the changes following seq to w.
+//A follower resuming from the sequence number of a previous one needs w to be in the state that one left it in,
+//for instance by giving w the same store. A seq of 0 starts from the first change.
+func NewFollower(w *Web, source FeedSource, seq uint64) *Follower {
+	return &Follower{web: w, source: source, seq: seq}
+}
+
+//Seq returns the sequence number of the last change applied
+func (f *Follower) Seq() uint64 {
+	return f.seq
+}
+
+//Sync applies the changes made since the last sync and returns how many there were.
+//If the source no longer holds them, its snapshot replaces the users and groups of the web instead,
+//which counts as one change.
+//Each change is applied at once like Update, without being validated.
+//Sync must not be called at the same time as anything else using the web.
+func (f *Follower) Sync() (int, error) {
+	changes, err := f.source.Changes(f.seq)
+	if errors.Cause(err) == ErrFeedGap {
+		snapshot, err := f.source.Snapshot()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read snapshot")
+		}
+		if err := f.apply(Change{Seq: snapshot.Seq, Snapshot: snapshot.PConf}); err != nil {
+			return 0, err
+		}
+		//changes made since the snapshot are applied by the next sync
+		return 1, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read changes")
+	}
+	for i, c := range changes {
+		if err := f.apply(c); err != nil {
+			return i, err
+		}
+	}
+	return len(changes), nil
+}
+
+//apply applies c to the web
+func (f *Follower) apply(c Change) error {
+	w := f.web
+	pc := c.Snapshot
+	if pc == nil {
+		pc = newPConf()
+		for name, e := range c.Groups {
+			if e != nil {
+				pc.Groups[name] = pconfGroup{Parents: e.Parents, Nodes: e.Nodes}
+			}
+		}
+		for name, e := range c.Users {
+			if e != nil {
+				pc.Users[name] = pconfUser{Groups: e.Groups, Nodes: e.Nodes}
+			}
+		}
+	}
+	//parse the change under the normalization policy of w
+	target := NewWeb()
+	target.norm = w.norm
+	if err := target.AddPConf(pc); err != nil {
+		return errors.Wrapf(err, "failed to apply change %v", c.Seq)
+	}
+
+	err := w.update(func(tx *Tx) error {
+		if c.Snapshot != nil {
+			for _, name := range w.GroupNames() {
+				if target.groups[name] == nil {
+					tx.DelGroup(name)
+				}
+			}
+			for _, name := range w.UserNames() {
+				if target.users[name] == nil {
+					tx.DelUser(name)
+				}
+			}
+		}
+		for name, e := range c.Groups {
+			if e == nil {
+				tx.DelGroup(name)
+			}
+		}
+		for name, e := range c.Users {
+			if e == nil {
+				tx.DelUser(name)
+			}
+		}
+		for _, g := range target.groups {
+			tx.AddGroup(g)
+		}
+		for _, u := range target.users {
+			tx.AddUser(u)
+		}
+		return nil
+	}, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to apply change %v", c.Seq)
+	}
+	f.seq = c.Seq
+	return nil
+}
@@ -0,0 +1,158 @@
+package perms
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+//jsonSource is a FeedSource which sends everything through JSON like a remote feed would
+type jsonSource struct {
+	feed *Feed
+}
+
+func (s jsonSource) Changes(seq uint64) ([]Change, error) {
+	changes, err := s.feed.Changes(seq)
+	if err != nil {
+		return nil, err
+	}
+	var out []Change
+	return out, roundTrip(changes, &out)
+}
+
+func (s jsonSource) Snapshot() (Snapshot, error) {
+	snapshot, err := s.feed.Snapshot()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var out Snapshot
+	return out, roundTrip(snapshot, &out)
+}
+
+func roundTrip(in interface{}, out interface{}) error {
+	byt, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(byt, out)
+}
+
+//samePConf checks if two webs have the same master pconf, ignoring empty lists
+func samePConf(a *Web, b *Web) bool {
+	aByt, _ := a.MasterPConf().Marshal()
+	bByt, _ := b.MasterPConf().Marshal()
+	return string(aByt) == string(bByt)
+}
+
+func TestFollower(t *testing.T) {
+	leader := testWeb()
+	feed := NewFeed(0)
+	leader.SetFeed(feed)
+	follower := NewWeb()
+	f := NewFollower(follower, jsonSource{feed}, 0)
+
+	sync := func(want int) {
+		t.Helper()
+		if n, err := f.Sync(); err != nil || n != want {
+			t.Fatalf("Sync() = %v, %v, want %v", n, err, want)
+		}
+		if !samePConf(follower, leader) {
+			t.Fatalf("follower = %+v, want %+v", follower.MasterPConf(), leader.MasterPConf())
+		}
+		if f.Seq() != feed.Seq() {
+			t.Errorf("Seq() = %v, want %v", f.Seq(), feed.Seq())
+		}
+	}
+	sync(1)
+
+	leader.AddGroup(&Group{Name: "auditor", Nodes: MustParseNodes(strings.NewReader("analytics.view"))})
+	leader.DelUser("bob")
+	leader.Update(func(tx *Tx) error {
+		tx.DelGroup("project_lead")
+		u := tx.GetUser("ammar")
+		u.Groups = []string{"manager", "auditor"}
+		tx.AddUser(u)
+		return nil
+	})
+	var events []Event
+	follower.Subscribe(func(e Event) { events = append(events, e) })
+	sync(3)
+	if len(events) != 3 || events[2].Type != BatchApplied || len(events[2].Batch) != 2 {
+		t.Errorf("follower published %+v", events)
+	}
+	sync(0)
+
+	leader.SetNormalization(Normalization{FoldCase: true})
+	leader.AddUser(&User{Name: "Carl", Groups: []string{"auditor"}})
+	sync(2)
+
+	//a new follower resumes from the sequence number of the last one
+	leader.AddPConf(MustParsePConf([]byte(`{"users": {"dan": {"nodes": ["projects.*"]}}}`)))
+	f = NewFollower(follower, jsonSource{feed}, f.Seq())
+	sync(1)
+}
+
+func TestFeed_ChangedPointer(t *testing.T) {
+	leader := testWeb()
+	leader.AddGroup(&Group{Name: "auditor"})
+	feed := NewFeed(0)
+	leader.SetFeed(feed)
+
+	//neither changing a user in place nor changing a snapshot may rewrite what the feed logged
+	u := leader.GetUser("ammar")
+	u.Groups[1] = "auditor"
+	snapshot, _ := feed.Snapshot()
+	snapshot.PConf.Users["bob"].Groups[0] = "auditor"
+
+	changes, err := feed.Changes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := changes[0].Snapshot.Users["ammar"].Groups; !reflect.DeepEqual(groups, []string{"project_lead", "manager"}) {
+		t.Errorf("logged snapshot has ammar in %v", groups)
+	}
+	snapshot, _ = feed.Snapshot()
+	if groups := snapshot.PConf.Users["ammar"].Groups; !reflect.DeepEqual(groups, []string{"project_lead", "manager"}) {
+		t.Errorf("Snapshot() has ammar in %v", groups)
+	}
+	if groups := snapshot.PConf.Users["bob"].Groups; !reflect.DeepEqual(groups, []string{"project_lead"}) {
+		t.Errorf("Snapshot() has bob in %v", groups)
+	}
+}
+
+func TestFollower_Snapshot(t *testing.T) {
+	leader := testWeb()
+	feed := NewFeed(2)
+	leader.SetFeed(feed)
+	for _, name := range []string{"carl", "dan", "erin"} {
+		leader.AddUser(&User{Name: name, Groups: []string{"manager"}})
+	}
+	if _, err := feed.Changes(1); errors.Cause(err) != ErrFeedGap {
+		t.Errorf("Changes(1) = %v, want ErrFeedGap", err)
+	}
+	if changes, err := feed.Changes(2); err != nil || len(changes) != 2 || changes[0].Seq != 3 {
+		t.Errorf("Changes(2) = %+v, %v", changes, err)
+	}
+	if _, err := feed.Changes(5); errors.Cause(err) != ErrFeedGap {
+		t.Errorf("Changes(5) = %v, want ErrFeedGap", err)
+	}
+
+	//the follower is too far behind and has users the leader deleted
+	follower := NewWeb()
+	store := NewMemoryStore()
+	follower.SetStore(store)
+	follower.AddUser(&User{Name: "zed"})
+	f := NewFollower(follower, feed, 1)
+	if n, err := f.Sync(); err != nil || n != 1 || f.Seq() != 4 {
+		t.Fatalf("Sync() = %v, %v, seq %v", n, err, f.Seq())
+	}
+	if !samePConf(follower, leader) {
+		t.Errorf("follower = %+v, want %+v", follower.MasterPConf(), leader.MasterPConf())
+	}
+	if users, _ := store.UserNames(); !reflect.DeepEqual(users, leader.UserNames()) {
+		t.Errorf("store users = %v, want %v", users, leader.UserNames())
+	}
+}
@@ -0,0 +1,352 @@
+package perms
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//DefaultCompactAfter is how many journal entries a FileStore keeps before compacting
+const DefaultCompactAfter = 1000
+
+//journal operations
+const (
+	journalSaveGroup = "save-group"
+	journalSaveUser  = "save-user"
+	journalDelGroup  = "del-group"
+	journalDelUser   = "del-user"
+)
+
+//journalEntry is a line of a FileStore journal
+type journalEntry struct {
+	Op    string      `json:"op"`
+	Name  string      `json:"name"`
+	Group *pconfGroup `json:"group,omitempty"`
+	User  *pconfUser  `json:"user,omitempty"`
+}
+
+//FileStore is a Store kept in files, for deployments without a database.
+//
+//The master PConf is a JSON PConf file which is only ever replaced atomically:
+//it is written to a temporary file which is synced and renamed over it.
+//Changes since the master was written are appended to a journal next to it, path + ".journal",
+//one JSON line per change, and synced before they are applied.
+//Once the journal holds SetCompactAfter entries, it is folded into a new master and emptied.
+//
+//A journal ending in a partially written line, as left by a crash, is truncated to its last complete line when opened.
+//FileStore is safe for concurrent use by one process.
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	journal *os.File
+	//entries is the number of entries in the journal
+	entries      int
+	compactAfter int
+	mem          *MemoryStore
+}
+
+//OpenFileStore opens the store kept at path, creating it if it does not exist
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, compactAfter: DefaultCompactAfter, mem: NewMemoryStore()}
+
+	byt, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to read master pconf")
+	}
+	if err == nil {
+		pc, err := ParsePConf(byt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %v", path)
+		}
+		for name, g := range pc.Groups {
+			g := g
+			if err := s.apply(journalEntry{Op: journalSaveGroup, Name: name, Group: &g}); err != nil {
+				return nil, errors.Wrapf(err, "failed to load %v", path)
+			}
+		}
+		for name, u := range pc.Users {
+			u := u
+			if err := s.apply(journalEntry{Op: journalSaveUser, Name: name, User: &u}); err != nil {
+				return nil, errors.Wrapf(err, "failed to load %v", path)
+			}
+		}
+	}
+
+	s.journal, err = os.OpenFile(path+".journal", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open journal")
+	}
+	if err := s.replay(); err != nil {
+		s.journal.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+//replay applies the journal and leaves it positioned at the end of its last complete line
+func (s *FileStore) replay() error {
+	rd := bufio.NewReader(s.journal)
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			//a line without a newline was cut short while being written
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read journal")
+		}
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return errors.Wrapf(err, "journal line %v is corrupt", lineNo)
+		}
+		if err := s.apply(e); err != nil {
+			return errors.Wrapf(err, "journal line %v is invalid", lineNo)
+		}
+		offset += int64(len(line))
+		s.entries++
+	}
+	if err := s.journal.Truncate(offset); err != nil {
+		return errors.Wrap(err, "failed to truncate journal")
+	}
+	_, err := s.journal.Seek(offset, io.SeekStart)
+	return err
+}
+
+//apply makes the change e describes in memory
+func (s *FileStore) apply(e journalEntry) error {
+	change, err := s.change(e)
+	if err != nil {
+		return err
+	}
+	return change()
+}
+
+//change checks e and returns a function making the change it describes in memory
+func (s *FileStore) change(e journalEntry) (func() error, error) {
+	switch e.Op {
+	case journalSaveGroup:
+		if e.Group == nil {
+			return nil, errors.Errorf("%v has no group", e.Op)
+		}
+		g := NewGroup(e.Name)
+		g.Parents = append(g.Parents, e.Group.Parents...)
+		for _, raw := range e.Group.Nodes {
+			node, err := ParseNode(raw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse node %q", raw)
+			}
+			g.Nodes = append(g.Nodes, node)
+		}
+		return func() error { return s.mem.SaveGroup(g) }, nil
+	case journalSaveUser:
+		if e.User == nil {
+			return nil, errors.Errorf("%v has no user", e.Op)
+		}
+		u := NewUser(e.Name)
+		u.Groups = append(u.Groups, e.User.Groups...)
+		for _, raw := range e.User.Nodes {
+			node, err := ParseNode(raw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse node %q", raw)
+			}
+			u.Nodes = append(u.Nodes, node)
+		}
+		return func() error { return s.mem.SaveUser(u) }, nil
+	case journalDelGroup:
+		return func() error { return s.mem.DelGroup(e.Name) }, nil
+	case journalDelUser:
+		return func() error { return s.mem.DelUser(e.Name) }, nil
+	}
+	return nil, errors.Errorf("unknown journal operation %q", e.Op)
+}
+
+//write checks e, appends it to the journal, syncs it and applies it.
+//An entry which could not be replayed is never written.
+func (s *FileStore) write(e journalEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journal == nil {
+		return errors.New("store is closed")
+	}
+
+	change, err := s.change(e)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	offset, err := s.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = s.journal.Write(append(line, '\n'))
+	if err == nil {
+		err = s.journal.Sync()
+	}
+	if err != nil {
+		//drop whatever part of the line was written so later lines follow a complete one
+		s.journal.Truncate(offset)
+		s.journal.Seek(offset, io.SeekStart)
+		return errors.Wrap(err, "failed to write journal")
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	s.entries++
+
+	//the change is durable in the journal, so a failed compaction is only retried on the next change
+	if s.entries >= s.compactAfter {
+		s.compact()
+	}
+	return nil
+}
+
+//SetCompactAfter sets how many journal entries s keeps before compacting, DefaultCompactAfter by default
+func (s *FileStore) SetCompactAfter(entries int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compactAfter = entries
+}
+
+//Compact writes a new master PConf and empties the journal
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journal == nil {
+		return errors.New("store is closed")
+	}
+	return s.compact()
+}
+
+//compact writes a new master PConf and empties the journal. s must be locked.
+//The journal is only emptied once the new master is in place,
+//and replaying a journal over a master which already contains it is harmless.
+func (s *FileStore) compact() error {
+	groups, users, _ := s.mem.Load()
+	pc := newPConf()
+	for _, g := range groups {
+		pc.Groups[g.Name] = pconfGroup{Parents: g.Parents, Nodes: g.Nodes.Strings()}
+	}
+	for _, u := range users {
+		pc.Users[u.Name] = pconfUser{Groups: u.Groups, Nodes: u.Nodes.Strings()}
+	}
+	byt, err := pc.MarshalFormat(FormatJSON)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, byt); err != nil {
+		return errors.Wrap(err, "failed to write master pconf")
+	}
+
+	if err := s.journal.Truncate(0); err != nil {
+		return errors.Wrap(err, "failed to truncate journal")
+	}
+	if _, err := s.journal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.entries = 0
+	return errors.Wrap(s.journal.Sync(), "failed to sync journal")
+}
+
+//writeFileAtomic replaces the file at path with byt so that it is either entirely old or entirely new after a crash
+func writeFileAtomic(path string, byt []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(byt); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	//the rename is only durable once the directory is synced,
+	//which not every platform supports
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+//Close compacts s and closes the journal
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journal == nil {
+		return nil
+	}
+	err := s.compact()
+	if closeErr := s.journal.Close(); err == nil {
+		err = closeErr
+	}
+	s.journal = nil
+	return err
+}
+
+//Load returns every group and user in s in order
+func (s *FileStore) Load() ([]*Group, []*User, error) {
+	return s.mem.Load()
+}
+
+//SaveGroup creates or replaces a group
+func (s *FileStore) SaveGroup(g *Group) error {
+	return errors.Wrapf(s.write(journalEntry{
+		Op:    journalSaveGroup,
+		Name:  g.Name,
+		Group: &pconfGroup{Parents: g.Parents, Nodes: g.Nodes.Strings()},
+	}), "failed to save group %q", g.Name)
+}
+
+//SaveUser creates or replaces a user
+func (s *FileStore) SaveUser(u *User) error {
+	return errors.Wrapf(s.write(journalEntry{
+		Op:   journalSaveUser,
+		Name: u.Name,
+		User: &pconfUser{Groups: u.Groups, Nodes: u.Nodes.Strings()},
+	}), "failed to save user %q", u.Name)
+}
+
+//DelGroup deletes a group
+func (s *FileStore) DelGroup(name string) error {
+	return errors.Wrapf(s.write(journalEntry{Op: journalDelGroup, Name: name}), "failed to delete group %q", name)
+}
+
+//DelUser deletes a user
+func (s *FileStore) DelUser(name string) error {
+	return errors.Wrapf(s.write(journalEntry{Op: journalDelUser, Name: name}), "failed to delete user %q", name)
+}
+
+//GroupNames returns the names of every group in s in order
+func (s *FileStore) GroupNames() ([]string, error) {
+	return s.mem.GroupNames()
+}
+
+//UserNames returns the names of every user in s in order
+func (s *FileStore) UserNames() ([]string, error) {
+	return s.mem.UserNames()
+}
@@ -0,0 +1,149 @@
+package perms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//openTestFileStore opens a file store in a new temporary directory
+func openTestFileStore(t *testing.T) (*FileStore, string) {
+	dir, err := ioutil.TempDir("", "perms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "perms.json")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func TestFileStore(t *testing.T) {
+	s, path := openTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer s.Close()
+	testStore(t, s)
+}
+
+func TestFileStore_Recovery(t *testing.T) {
+	s, path := openTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer s.Close()
+
+	web := NewWeb()
+	web.SetStore(s)
+	web.AddPConf(testWeb().MasterPConf())
+	web.DelUser("bob")
+
+	//a crash leaves only the journal, ending in part of a line
+	journal, err := os.OpenFile(path+".journal", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := journal.Stat()
+	journal.WriteString(`{"op":"save-user","name":"carl","us`)
+	journal.Close()
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	loaded := NewWeb()
+	loaded.SetStore(reopened)
+	if !reflect.DeepEqual(loaded.MasterPConf(), web.MasterPConf()) {
+		t.Errorf("recovered %+v, want %+v", loaded.MasterPConf(), web.MasterPConf())
+	}
+	if after, _ := os.Stat(path + ".journal"); after.Size() != before.Size() {
+		t.Errorf("journal is %v bytes, want it truncated to %v", after.Size(), before.Size())
+	}
+
+	//writes after recovery follow the last complete line
+	loaded.AddUser(&User{Name: "carl"})
+	again, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if names, _ := again.UserNames(); !reflect.DeepEqual(names, []string{"ammar", "carl"}) {
+		t.Errorf("UserNames() = %v, want [ammar carl]", names)
+	}
+}
+
+func TestFileStore_Corrupt(t *testing.T) {
+	s, path := openTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	s.Close()
+
+	//only the last line can be cut short by a crash
+	ioutil.WriteFile(path+".journal", []byte("{\"op\":\"del-\n{\"op\":\"del-user\",\"name\":\"bob\"}\n"), 0644)
+	if _, err := OpenFileStore(path); err == nil {
+		t.Errorf("OpenFileStore() opened a corrupt journal")
+	}
+}
+
+func TestFileStore_Rejected(t *testing.T) {
+	s, path := openTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	s.SaveUser(&User{Name: "ammar"})
+
+	//a node built in code rather than parsed may not survive being read back
+	bad := &User{Name: "bob", Nodes: Nodes{{Parts: []string{"projects", "my project", "build"}}}}
+	if err := s.SaveUser(bad); err == nil {
+		t.Errorf("SaveUser() saved a node which cannot be parsed")
+	}
+	if names, _ := s.UserNames(); !reflect.DeepEqual(names, []string{"ammar"}) {
+		t.Errorf("UserNames() = %v, want [ammar]", names)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() after a rejected save = %v", err)
+	}
+	defer reopened.Close()
+	if names, _ := reopened.UserNames(); !reflect.DeepEqual(names, []string{"ammar"}) {
+		t.Errorf("UserNames() = %v, want [ammar]", names)
+	}
+}
+
+func TestFileStore_Compact(t *testing.T) {
+	s, path := openTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer s.Close()
+	s.SetCompactAfter(4)
+
+	web := NewWeb()
+	web.SetStore(s)
+	web.AddPConf(testWeb().MasterPConf())
+	web.DelGroup("default")
+
+	//the pconf makes 5 entries and the deletion 1, so the journal was compacted after 4 and holds 2
+	if s.entries != 2 {
+		t.Errorf("journal holds %v entries, want 2", s.entries)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path + ".journal"); info.Size() != 0 {
+		t.Errorf("journal is %v bytes after Compact()", info.Size())
+	}
+
+	byt, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, _ := MustParsePConf(byt).Marshal()
+	want, _ := web.MasterPConf().Marshal()
+	if string(master) != string(want) {
+		t.Errorf("master = %s, want %s", master, want)
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	if len(files) != 2 {
+		t.Errorf("compacting left %v files behind, want the master and the journal", len(files))
+	}
+}
@@ -0,0 +1,158 @@
+package perms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+//ErrUnknownFormat is returned when the format of a PConf file cannot be determined
+var ErrUnknownFormat = errors.New("unknown pconf format")
+
+//Format is an encoding of a PConf
+type Format int
+
+//pconf formats
+const (
+	FormatJSON Format = iota
+	FormatYAML
+	FormatTOML
+	//FormatDSL is the permissions DSL, see ParseDSL
+	FormatDSL
+)
+
+//String returns the name of f
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatYAML:
+		return "yaml"
+	case FormatTOML:
+		return "toml"
+	case FormatDSL:
+		return "dsl"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+//FormatOf returns the format of a PConf file from its extension:
+//.json, .yaml or .yml, .toml, or .perms for the DSL
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	case ".perms":
+		return FormatDSL, nil
+	}
+	return 0, errors.Wrap(ErrUnknownFormat, path)
+}
+
+//fileFormat returns the format of a PConf file, assuming JSON for unknown extensions
+func fileFormat(path string) Format {
+	if format, err := FormatOf(path); err == nil {
+		return format
+	}
+	return FormatJSON
+}
+
+//ParsePConfFormat parses a pconf encoded in format.
+//JSON, YAML and TOML documents are validated against the schema returned by PConfSchema,
+//so unknown keys and invalid nodes are reported as a *SchemaError.
+func ParsePConfFormat(byt []byte, format Format) (*PConf, error) {
+	pconf := newPConf()
+	var err error
+	//decode decodes byt into pconf once it matches the schema
+	decode := func(unmarshal func([]byte, interface{}) error) error {
+		var document interface{}
+		if err := unmarshal(byt, &document); err != nil {
+			return err
+		}
+		if err := validatePConf(document); err != nil {
+			return err
+		}
+		return unmarshal(byt, pconf)
+	}
+	switch format {
+	case FormatJSON:
+		err = decode(json.Unmarshal)
+	case FormatYAML:
+		err = decode(yaml.Unmarshal)
+	case FormatTOML:
+		err = decode(toml.Unmarshal)
+	case FormatDSL:
+		var d *DSL
+		if d, err = ParseDSL(bytes.NewReader(byt)); err == nil {
+			pconf = d.PConf()
+		}
+	default:
+		return nil, errors.Wrapf(ErrUnknownFormat, "%v", format)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode")
+	}
+
+	//an empty table or mapping decodes to nil in some formats
+	if pconf.Groups == nil {
+		pconf.Groups = make(map[string]pconfGroup)
+	}
+	if pconf.Users == nil {
+		pconf.Users = make(map[string]pconfUser)
+	}
+	return pconf, nil
+}
+
+//withEmptyLists returns a copy of pc with empty lists in place of nil ones
+func (pc *PConf) withEmptyLists() *PConf {
+	out := &PConf{Include: pc.Include, Groups: make(map[string]pconfGroup, len(pc.Groups)), Users: make(map[string]pconfUser, len(pc.Users))}
+	for name, g := range pc.Groups {
+		out.Groups[name] = pconfGroup{Parents: append([]string{}, g.Parents...), Nodes: append([]string{}, g.Nodes...)}
+	}
+	for name, u := range pc.Users {
+		out.Users[name] = pconfUser{Groups: append([]string{}, u.Groups...), Nodes: append([]string{}, u.Nodes...)}
+	}
+	return out
+}
+
+//MarshalFormat marshals pc in a human readable form of format.
+//Missing lists are written as empty ones in JSON rather than as null.
+func (pc *PConf) MarshalFormat(format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return pc.withEmptyLists().PrettyMarshal()
+	case FormatYAML:
+		buf := new(bytes.Buffer)
+		enc := yaml.NewEncoder(buf)
+		enc.SetIndent(4)
+		if err := enc.Encode(pc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatTOML:
+		buf := new(bytes.Buffer)
+		if err := toml.NewEncoder(buf).Encode(pc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatDSL:
+		buf := new(bytes.Buffer)
+		if err := WriteDSL(buf, pc, nil); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, errors.Wrapf(ErrUnknownFormat, "%v", format)
+}
@@ -0,0 +1,141 @@
+package perms
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const formatJSON = `{
+    "include": ["base.json"],
+    "groups": {
+        "project_lead": {"nodes": ["analytics.*"]},
+        "manager": {"parents": ["project_lead"], "nodes": ["projects.*", "-projects.secret.*"]},
+        "auditors.eu": {}
+    },
+    "users": {
+        "ammar": {"groups": ["manager"], "nodes": ["-projects.*.chat.moderate"]}
+    }
+}`
+
+const formatYAML = `# comments are allowed
+include: [base.json]
+groups:
+    project_lead:
+        nodes: [analytics.*]
+    manager:
+        parents: [project_lead]
+        nodes:
+            - projects.*
+            - -projects.secret.*
+    auditors.eu: {}
+users:
+    ammar:
+        groups: [manager]
+        nodes: [-projects.*.chat.moderate]
+`
+
+const formatTOML = `# comments are allowed
+include = ["base.json"]
+
+[groups.project_lead]
+nodes = ["analytics.*"]
+
+[groups.manager]
+parents = ["project_lead"]
+nodes = ["projects.*", "-projects.secret.*"]
+
+[groups."auditors.eu"]
+
+[users.ammar]
+groups = ["manager"]
+nodes = ["-projects.*.chat.moderate"]
+`
+
+func TestParsePConfFormat(t *testing.T) {
+	want := MustParsePConf([]byte(formatJSON))
+	tests := []struct {
+		format Format
+		input  string
+	}{
+		{FormatJSON, formatJSON},
+		{FormatYAML, formatYAML},
+		{FormatTOML, formatTOML},
+		{FormatDSL, formatDSL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			pconf, err := ParsePConfFormat([]byte(tt.input), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pconf, want) {
+				t.Errorf("ParsePConfFormat() = %+v, want %+v", pconf, want)
+			}
+
+			//every format must round trip to the same web
+			for _, to := range []Format{FormatJSON, FormatYAML, FormatTOML, FormatDSL} {
+				byt, err := pconf.MarshalFormat(to)
+				if err != nil {
+					t.Fatalf("MarshalFormat(%v) = %v", to, err)
+				}
+				again, err := ParsePConfFormat(byt, to)
+				if err != nil {
+					t.Fatalf("ParsePConfFormat(%v) = %v\n%s", to, err, byt)
+				}
+				a, b := NewWeb(), NewWeb()
+				a.AddPConf(pconf)
+				b.AddPConf(again)
+				if !reflect.DeepEqual(a.MasterPConf(), b.MasterPConf()) || !reflect.DeepEqual(again.Include, pconf.Include) {
+					t.Errorf("%v does not round trip through %v:\n%s", tt.format, to, byt)
+				}
+			}
+		})
+	}
+
+	if _, err := ParsePConfFormat([]byte("groups: [a"), FormatYAML); err == nil {
+		t.Errorf("invalid yaml parsed")
+	}
+	if _, err := ParsePConfFormat(nil, Format(10)); errors.Cause(err) != ErrUnknownFormat {
+		t.Errorf("unknown format = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		path   string
+		format Format
+		err    error
+	}{
+		{"perms.json", FormatJSON, nil},
+		{"conf/perms.YAML", FormatYAML, nil},
+		{"perms.yml", FormatYAML, nil},
+		{"perms.toml", FormatTOML, nil},
+		{"perms.perms", FormatDSL, nil},
+		{"perms.conf", 0, ErrUnknownFormat},
+	}
+	for _, tt := range tests {
+		format, err := FormatOf(tt.path)
+		if format != tt.format || errors.Cause(err) != tt.err {
+			t.Errorf("FormatOf(%q) = %v, %v, want %v, %v", tt.path, format, err, tt.format, tt.err)
+		}
+	}
+}
+
+func TestReadPConfFile_Formats(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"root.yaml": "include: [users.toml]\ngroups:\n    manager:\n        nodes: [projects.*]\n",
+		"users.toml": `[users.ammar]
+groups = ["manager"]`,
+	})
+
+	web := NewWeb()
+	if err := web.LoadFile(filepath.Join(dir, "root.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if !web.CheckUserHasPermission("ammar", MustParseNode("projects.webserver")) {
+		t.Errorf("files of different formats were not combined")
+	}
+}
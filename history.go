@@ -0,0 +1,155 @@
+package perms
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//ErrNoVersion is returned for versions a History does not hold
+var ErrNoVersion = errors.New("version does not exist")
+
+//Version is the state of a Web after a change
+type Version struct {
+	//Number increases by one with every version
+	Number int       `json:"number"`
+	Time   time.Time `json:"time"`
+	//Actor is the actor set on the web when the version was made, see Web.SetActor
+	Actor string `json:"actor,omitempty"`
+	//PConf is the master pconf of the web. It must not be changed.
+	PConf *PConf `json:"pconf"`
+}
+
+//History holds numbered versions of a Web, see Web.SetHistory.
+//It is safe for concurrent use.
+type History struct {
+	mu       sync.Mutex
+	versions []Version
+	limit    int
+	//last is the marshaled pconf of the newest version
+	last []byte
+}
+
+//NewHistory returns an empty history which keeps the newest limit versions.
+//A limit of 0 keeps every version.
+func NewHistory(limit int) *History {
+	return &History{limit: limit}
+}
+
+//add adds pc as a new version, unless it is the same as the newest version
+func (h *History) add(pc *PConf, actor string) {
+	byt, err := pc.Marshal()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil && string(byt) == string(h.last) {
+		return
+	}
+	h.last = byt
+
+	number := 1
+	if len(h.versions) > 0 {
+		number = h.versions[len(h.versions)-1].Number + 1
+	}
+	h.versions = append(h.versions, Version{Number: number, Time: time.Now(), Actor: actor, PConf: pc})
+	if h.limit > 0 && len(h.versions) > h.limit {
+		h.versions = append([]Version{}, h.versions[len(h.versions)-h.limit:]...)
+	}
+}
+
+//Versions returns the versions h holds, oldest first
+func (h *History) Versions() []Version {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Version{}, h.versions...)
+}
+
+//Version returns the version numbered number
+func (h *History) Version(number int) (Version, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, v := range h.versions {
+		if v.Number == number {
+			return v, nil
+		}
+	}
+	return Version{}, errors.Wrapf(ErrNoVersion, "version %v", number)
+}
+
+//Diff compares two versions, see Diff
+func (h *History) Diff(from int, to int, probes Nodes) (WebDiff, error) {
+	before, err := h.Version(from)
+	if err != nil {
+		return WebDiff{}, err
+	}
+	after, err := h.Version(to)
+	if err != nil {
+		return WebDiff{}, err
+	}
+	return DiffPConfs([]*PConf{before.PConf}, []*PConf{after.PConf}, probes)
+}
+
+//History returns the history of w, or nil if it has none
+func (w *Web) History() *History {
+	return w.history
+}
+
+//SetHistory keeps versions of w in h.
+//The current state of w becomes a version, as does the state after every change
+//made by AddUser, DelUser, AddGroup, DelGroup, AddPConf, Reset, Rollback and Update which changes something.
+//Making a version loads every user of a LazyStore. A nil h stops keeping versions.
+func (w *Web) SetHistory(h *History) {
+	w.history = h
+	if h != nil {
+		h.add(w.MasterPConf(), w.actor)
+	}
+}
+
+//Rollback returns w to a version in its history, which makes a new version.
+//Nothing changes if an error is returned,
+//though if w has a store, some of the users and groups may have been saved to it.
+//Nothing is deleted from the store unless everything was saved.
+func (w *Web) Rollback(number int) error {
+	if w.history == nil {
+		return errors.New("web has no history")
+	}
+	v, err := w.history.Version(number)
+	if err != nil {
+		return err
+	}
+	if err := w.loadUsers(); err != nil {
+		return err
+	}
+
+	target := NewWeb()
+	target.norm = w.norm
+	if err := target.AddPConf(v.PConf); err != nil {
+		return errors.Wrapf(err, "failed to restore version %v", number)
+	}
+
+	if err := w.saveReplacement(target); err != nil {
+		return err
+	}
+
+	var events []AuditEvent
+	if w.tracking() {
+		for _, name := range mergeNames(w.GroupNames(), target.GroupNames()) {
+			before, after := w.groupState(name), auditGroup(target.groups[name])
+			if !reflect.DeepEqual(before, after) {
+				events = append(events, AuditEvent{Action: AuditRollback, Kind: "group", Name: name, Before: before, After: after})
+			}
+		}
+		for _, name := range mergeNames(w.UserNames(), target.UserNames()) {
+			before, after := w.userState(name), auditUser(target.users[name])
+			if !reflect.DeepEqual(before, after) {
+				events = append(events, AuditEvent{Action: AuditRollback, Kind: "user", Name: name, Before: before, After: after})
+			}
+		}
+	}
+
+	w.groups, w.users = target.groups, target.users
+	w.groupSources, w.userSources = target.groupSources, target.userSources
+	w.groupStates, w.userStates = target.groupStates, target.userStates
+	return w.commit(events...)
+}
@@ -0,0 +1,166 @@
+package perms
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWeb_SetHistory(t *testing.T) {
+	web := testWeb()
+	original := web.MasterPConf()
+	history := NewHistory(0)
+	web.SetHistory(history)
+
+	web.SetActor("alice")
+	web.AddGroup(&Group{Name: "auditor", Nodes: MustParseNodes(strings.NewReader("analytics.view"))})
+	web.DelUser("nobody")
+	web.SetActor("bob")
+	web.DelUser("bob")
+
+	versions := history.Versions()
+	var numbers []int
+	var actors []string
+	for _, v := range versions {
+		numbers = append(numbers, v.Number)
+		actors = append(actors, v.Actor)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(numbers, want) {
+		t.Fatalf("versions = %v, want %v", numbers, want)
+	}
+	if want := []string{"", "alice", "bob"}; !reflect.DeepEqual(actors, want) {
+		t.Errorf("actors = %v, want %v", actors, want)
+	}
+
+	d, err := history.Diff(1, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Groups) != 1 || d.Groups[0].Name != "auditor" || len(d.Users) != 1 || d.Users[0].Kind != Removed {
+		t.Errorf("Diff(1, 3) = %v", d)
+	}
+
+	if err := web.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(web.MasterPConf(), original) {
+		t.Errorf("Rollback(1) = %+v, want %+v", web.MasterPConf(), original)
+	}
+	if v := history.Versions(); len(v) != 4 || v[3].Number != 4 {
+		t.Errorf("Rollback() did not make a new version")
+	}
+	if !web.CheckUserHasPermission("bob", MustParseNode("analytics.view")) {
+		t.Errorf("bob was not restored")
+	}
+
+	if err := web.Rollback(10); errors.Cause(err) != ErrNoVersion {
+		t.Errorf("Rollback(10) = %v, want ErrNoVersion", err)
+	}
+	if _, err := history.Diff(1, 10, nil); errors.Cause(err) != ErrNoVersion {
+		t.Errorf("Diff(1, 10) = %v, want ErrNoVersion", err)
+	}
+}
+
+func TestWeb_SetHistory_ChangedPointer(t *testing.T) {
+	web := testWeb()
+	web.AddGroup(&Group{Name: "auditor"})
+	history := NewHistory(0)
+	web.SetHistory(history)
+
+	//changing the slices of a user in place must not change the versions already made
+	u := web.GetUser("ammar")
+	u.Groups[1] = "auditor"
+	web.AddUser(u)
+
+	v, err := history.Version(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := v.PConf.Users["ammar"].Groups; groups[1] != "manager" {
+		t.Errorf("version 1 has ammar in %v", groups)
+	}
+	if d, err := history.Diff(1, 2, nil); err != nil || len(d.Users) != 1 {
+		t.Errorf("Diff(1, 2) = %v, %v", d, err)
+	}
+	if err := web.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(web.GetUser("ammar").Groups, []string{"project_lead", "manager"}) {
+		t.Errorf("Rollback(1) left ammar in %v", web.GetUser("ammar").Groups)
+	}
+}
+
+func TestHistory_Limit(t *testing.T) {
+	web := NewWeb()
+	history := NewHistory(2)
+	web.SetHistory(history)
+	for _, name := range []string{"a", "b", "c"} {
+		web.AddUser(&User{Name: name})
+	}
+	versions := history.Versions()
+	if len(versions) != 2 || versions[0].Number != 3 || versions[1].Number != 4 {
+		t.Errorf("versions = %+v, want 3 and 4", versions)
+	}
+	if err := web.Rollback(1); errors.Cause(err) != ErrNoVersion {
+		t.Errorf("Rollback() to a dropped version = %v, want ErrNoVersion", err)
+	}
+}
+
+func TestWeb_Rollback_StoreFailure(t *testing.T) {
+	store := NewMemoryStore()
+	web := NewWeb()
+	web.SetStore(store)
+	web.AddPConf(testWeb().MasterPConf())
+	web.SetHistory(NewHistory(0))
+	web.DelGroup("manager")
+	web.AddUser(&User{Name: "carl"})
+	want := web.MasterPConf()
+
+	web.store = userFailingStore{store}
+	if err := web.Rollback(1); errors.Cause(err) != errStore {
+		t.Fatalf("Rollback() = %v, want %v", err, errStore)
+	}
+	if !reflect.DeepEqual(web.MasterPConf(), want) {
+		t.Errorf("a failed rollback changed the web")
+	}
+	//the failure happened before anything was deleted
+	if users, _ := store.UserNames(); !reflect.DeepEqual(users, []string{"ammar", "bob", "carl"}) {
+		t.Errorf("a failed rollback deleted carl from the store")
+	}
+}
+
+func TestWeb_Rollback_Store(t *testing.T) {
+	store := NewMemoryStore()
+	web := NewWeb()
+	web.SetStore(store)
+	web.AddPConf(testWeb().MasterPConf())
+	web.SetHistory(NewHistory(0))
+
+	var events []AuditEvent
+	web.SetAuditSink(AuditFunc(func(e AuditEvent) error {
+		events = append(events, e)
+		return nil
+	}))
+	web.DelGroup("manager")
+	web.AddUser(&User{Name: "carl"})
+	events = nil
+
+	if err := web.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewWeb()
+	loaded.SetStore(store)
+	if !reflect.DeepEqual(loaded.MasterPConf(), web.MasterPConf()) {
+		t.Errorf("store = %+v, want %+v", loaded.MasterPConf(), web.MasterPConf())
+	}
+
+	var changed []string
+	for _, e := range events {
+		changed = append(changed, e.Action+" "+e.Kind+" "+e.Name)
+	}
+	if want := []string{"rollback group manager", "rollback user carl"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("events = %v, want %v", changed, want)
+	}
+}
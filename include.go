@@ -0,0 +1,146 @@
+package perms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//ErrIncludeCycle is returned when a PConf file includes itself, directly or not
+var ErrIncludeCycle = errors.New("include cycle")
+
+//PConfFile is a PConf and the file it was read from
+type PConfFile struct {
+	File  string
+	PConf *PConf
+}
+
+//ReadPConfFile reads the PConf at path along with every file it includes,
+//in the order they should be added to a Web.
+//
+//Each entry of Include is a path or a glob relative to the directory of the including file.
+//Included files come before the file including them, in the order they are listed,
+//so the including file takes precedence. Glob matches are sorted and may be empty.
+//A file included more than once is only read the first time.
+//Each file is decoded according to its extension, see FormatOf. Unknown extensions are read as JSON.
+func ReadPConfFile(path string) ([]PConfFile, error) {
+	return readPConfFile(path, nil)
+}
+
+//readPConfFile is ReadPConfFile, calling before, if it is not nil, with each file before it is read
+func readPConfFile(path string, before func(file string)) ([]PConfFile, error) {
+	r := &includeReader{visited: make(map[string]bool), before: before}
+	if err := r.read(path); err != nil {
+		return nil, err
+	}
+	return r.files, nil
+}
+
+//includeReader contains the state of ReadPConfFile
+type includeReader struct {
+	files   []PConfFile
+	visited map[string]bool
+	//stack holds the files being read, outermost first
+	stack  []includeFrame
+	before func(file string)
+}
+
+//includeFrame is a file being read by includeReader
+type includeFrame struct {
+	abs  string
+	path string
+}
+
+func (r *includeReader) read(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for i, frame := range r.stack {
+		if frame.abs == abs {
+			cycle := make([]string, 0, len(r.stack)-i+1)
+			for _, f := range r.stack[i:] {
+				cycle = append(cycle, f.path)
+			}
+			cycle = append(cycle, path)
+			return errors.Wrap(ErrIncludeCycle, strings.Join(cycle, " -> "))
+		}
+	}
+	if r.visited[abs] {
+		return nil
+	}
+	r.visited[abs] = true
+
+	if r.before != nil {
+		r.before(path)
+	}
+	byt, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pconf, err := ParsePConfFormat(byt, fileFormat(path))
+	if err != nil {
+		return errors.Wrap(err, path)
+	}
+
+	r.stack = append(r.stack, includeFrame{abs: abs, path: path})
+	for _, include := range pconf.Include {
+		paths, err := resolveInclude(filepath.Dir(path), include)
+		if err != nil {
+			return errors.Wrapf(err, "%v: failed to include %q", path, include)
+		}
+		for _, p := range paths {
+			if err := r.read(p); err != nil {
+				return err
+			}
+		}
+	}
+	r.stack = r.stack[:len(r.stack)-1]
+
+	r.files = append(r.files, PConfFile{File: path, PConf: pconf})
+	return nil
+}
+
+//resolveInclude returns the files an include entry refers to
+func resolveInclude(dir string, include string) ([]string, error) {
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(dir, include)
+	}
+	if !strings.ContainsAny(include, "*?[") {
+		//report missing files instead of silently matching nothing
+		if _, err := os.Stat(include); err != nil {
+			return nil, err
+		}
+		return []string{include}, nil
+	}
+	//Glob sorts its matches
+	return filepath.Glob(include)
+}
+
+//LoadFile adds the PConf at path and every file it includes to w, see ReadPConfFile.
+//Conflicts are reported with the file names involved.
+func (w *Web) LoadFile(path string) error {
+	files, err := ReadPConfFile(path)
+	if err != nil {
+		return err
+	}
+	return w.addPConfFiles(files)
+}
+
+//addPConfFiles adds files in order
+func (w *Web) addPConfFiles(files []PConfFile) error {
+	for _, f := range files {
+		err := w.AddPConfFrom(f.File, f.PConf)
+		//conflicts already name the files involved
+		if err != nil && errors.Cause(err) != ErrConflict {
+			err = errors.Wrap(err, f.File)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
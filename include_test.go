@@ -0,0 +1,90 @@
+package perms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+//writeTree writes files relative to a temporary directory and returns it
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "perms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadPConfFile(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"prod.json":          `{"include": ["base/base.json", "teams/*.json"], "groups": {"manager": {"nodes": ["-projects.secret.*"]}}}`,
+		"base/base.json":     `{"include": ["../teams/billing.json"], "groups": {"manager": {"nodes": ["projects.*"]}}}`,
+		"teams/billing.json": `{"users": {"ammar": {"groups": ["manager"]}}}`,
+		"teams/search.json":  `{"users": {"bob": {"groups": ["manager"]}}}`,
+	})
+
+	files, err := ReadPConfFile(filepath.Join(dir, "prod.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f.File)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"teams/billing.json", "base/base.json", "teams/search.json", "prod.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+
+	web := NewWeb()
+	if err := web.LoadFile(filepath.Join(dir, "prod.json")); err != nil {
+		t.Fatal(err)
+	}
+	if web.CheckUserHasPermission("ammar", MustParseNode("projects.webserver.build")) {
+		t.Errorf("the including file did not take precedence")
+	}
+	if len(web.UserNames()) != 2 {
+		t.Errorf("users = %v", web.UserNames())
+	}
+}
+
+func TestReadPConfFile_Errors(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"a.json":       `{"include": ["b.json"]}`,
+		"b.json":       `{"include": ["a.json"]}`,
+		"missing.json": `{"include": ["nope.json"]}`,
+		"empty.json":   `{"include": ["nope/*.json"]}`,
+	})
+
+	_, err := ReadPConfFile(filepath.Join(dir, "a.json"))
+	if errors.Cause(err) != ErrIncludeCycle {
+		t.Errorf("cycle: err = %v, want ErrIncludeCycle", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "a.json -> "+filepath.Join(dir, "b.json")+" -> "+filepath.Join(dir, "a.json")) {
+		t.Errorf("cycle: err = %v", err)
+	}
+
+	if _, err := ReadPConfFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("missing include succeeded")
+	}
+	if files, err := ReadPConfFile(filepath.Join(dir, "empty.json")); err != nil || len(files) != 1 {
+		t.Errorf("glob matching nothing = %v, %v", files, err)
+	}
+}
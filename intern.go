@@ -0,0 +1,80 @@
+package perms
+
+import (
+	"strings"
+	"sync"
+)
+
+//Interner caches parsed nodes so that parsing the same string again doesn't allocate.
+//Namespaces are shared between the nodes it returns.
+//It is safe for concurrent use.
+type Interner struct {
+	mu    sync.RWMutex
+	max   int
+	nodes map[string]Node
+	parts map[string]string
+}
+
+//NewInterner returns an instantiated interner that caches at most max nodes.
+//Once full, nodes are still parsed but no longer cached.
+//A max of 0 or less caches every node.
+func NewInterner(max int) *Interner {
+	return &Interner{
+		max:   max,
+		nodes: make(map[string]Node),
+		parts: make(map[string]string),
+	}
+}
+
+//Parse parses raw like ParseNode, returning the cached node if raw has been parsed before.
+//Nodes that fail to parse are not cached.
+//The returned node's Parts must not be modified.
+func (in *Interner) Parse(raw string) (Node, error) {
+	in.mu.RLock()
+	node, ok := in.nodes[raw]
+	in.mu.RUnlock()
+	if ok {
+		return node, nil
+	}
+
+	node, err := ParseNode(raw)
+	if err != nil {
+		return Node{}, err
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if cached, ok := in.nodes[raw]; ok {
+		return cached, nil
+	}
+	if in.max > 0 && len(in.nodes) >= in.max {
+		return node, nil
+	}
+	for i, part := range node.Parts {
+		if interned, ok := in.parts[part]; ok {
+			node.Parts[i] = interned
+			continue
+		}
+		part = strings.Clone(part)
+		in.parts[part] = part
+		node.Parts[i] = part
+	}
+	in.nodes[strings.Clone(raw)] = node
+	return node, nil
+}
+
+//MustParse parses raw or panics
+func (in *Interner) MustParse(raw string) Node {
+	node, err := in.Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+//Len returns the number of cached nodes
+func (in *Interner) Len() int {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return len(in.nodes)
+}
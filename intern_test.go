@@ -0,0 +1,35 @@
+package perms
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterner(t *testing.T) {
+	in := NewInterner(2)
+
+	a := in.MustParse("projects.webserver.build")
+	b := in.MustParse("-projects.webserver.chat")
+	if !reflect.DeepEqual(a, MustParseNode("projects.webserver.build")) {
+		t.Errorf("Parse() = %+v", a)
+	}
+	if !b.Negate || b.String() != "-projects.webserver.chat" {
+		t.Errorf("Parse() = %+v", b)
+	}
+
+	if _, err := in.Parse("bad node"); err != ErrWhitespace {
+		t.Errorf("Parse() error = %v, want %v", err, ErrWhitespace)
+	}
+
+	in.MustParse("analytics.view")
+	if in.Len() != 2 {
+		t.Errorf("Len() = %v, want 2", in.Len())
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		in.MustParse("projects.webserver.build")
+	})
+	if allocs != 0 {
+		t.Errorf("Parse allocated %v times for a cached node", allocs)
+	}
+}
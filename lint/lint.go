@@ -0,0 +1,332 @@
+//Package lint analyzes PConfs for mistakes which are valid but almost certainly unintended
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/stratexio/perms"
+)
+
+//checks reported by Lint
+const (
+	//CheckInvalidNode reports nodes which fail to parse.
+	//PConfs returned by ParsePConf never contain any.
+	CheckInvalidNode = "invalid-node"
+	//CheckUndefinedGroup reports users and groups in groups no PConf defines
+	CheckUndefinedGroup = "undefined-group"
+	//CheckUnusedGroup reports groups no user or group references
+	CheckUnusedGroup = "unused-group"
+	//CheckShadowed reports grants entirely negated by the same user or group
+	CheckShadowed = "shadowed"
+	//CheckUselessNegation reports negations which negate nothing the user or group could be granted
+	CheckUselessNegation = "useless-negation"
+	//CheckDuplicate reports nodes repeated in the same user or group
+	CheckDuplicate = "duplicate"
+	//CheckRedundant reports nodes already covered by other nodes of the same user or group
+	CheckRedundant = "redundant"
+	//CheckBroad reports grants of every permission outside of the allow list
+	CheckBroad = "broad"
+	//CheckOverwritten reports users and groups replaced by a later PConf,
+	//or declared again by one if the merge strategy is MergeError.
+	//Nothing is reported under MergeAppend, where every declaration takes effect.
+	CheckOverwritten = "overwritten"
+	//CheckUnknownNode reports nodes which match no registered permission
+	CheckUnknownNode = "unknown-node"
+)
+
+//Source is a PConf and the file it was read from
+type Source struct {
+	File  string
+	PConf *perms.PConf
+}
+
+//Config configures Lint
+type Config struct {
+	//BroadGroups and BroadUsers may be granted every permission
+	BroadGroups []string
+	BroadUsers  []string
+	//Registry enables CheckUnknownNode if it is not nil
+	Registry *perms.Registry
+	//Merge is how users and groups declared by several sources are combined, see perms.Web.SetMergeStrategy
+	Merge perms.MergeStrategy
+}
+
+//Finding is a problem found by Lint
+type Finding struct {
+	File string `json:"file"`
+	//Path is the JSON path of the problem within File, such as $.groups.manager.nodes[1]
+	Path    string `json:"path"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+//String returns a human readable version of f
+func (f Finding) String() string {
+	return fmt.Sprintf("%v: %v: %v (%v)", f.File, f.Path, f.Message, f.Check)
+}
+
+//path returns the JSON path of a member of the users or groups of a PConf
+func path(kind string, name string, rest ...interface{}) string {
+	p := perms.JSONPath("$."+kind, name)
+	for _, r := range rest {
+		switch r := r.(type) {
+		case int:
+			p += fmt.Sprintf("[%v]", r)
+		default:
+			p += fmt.Sprintf(".%v", r)
+		}
+	}
+	return p
+}
+
+//definition is where the user or group which takes effect is defined
+type definition struct {
+	source int
+	nodes  perms.Nodes
+	//refs are the groups or parents it references
+	refs []string
+}
+
+//linter contains the state of a Lint run
+type linter struct {
+	sources  []Source
+	config   Config
+	findings []Finding
+
+	groups map[string]*definition
+	users  map[string]*definition
+}
+
+//Lint analyzes sources as if they were added to a Web in order
+func Lint(sources []Source, config Config) []Finding {
+	l := &linter{
+		sources: sources,
+		config:  config,
+		groups:  make(map[string]*definition),
+		users:   make(map[string]*definition),
+	}
+
+	for i, source := range sources {
+		for name, g := range source.PConf.Groups {
+			l.define(l.groups, name, i, g.Nodes, g.Parents)
+		}
+		for name, u := range source.PConf.Users {
+			l.define(l.users, name, i, u.Nodes, u.Groups)
+		}
+	}
+
+	for i, source := range sources {
+		l.lintSource(i, source)
+	}
+	return l.findings
+}
+
+//define records a declaration of a user or group.
+//Under MergeAppend it extends an earlier one, otherwise the last declaration takes effect.
+func (l *linter) define(defs map[string]*definition, name string, source int, nodes []string, refs []string) {
+	if def := defs[name]; def != nil && l.config.Merge == perms.MergeAppend {
+		def.source = source
+		def.nodes = append(def.nodes, parseValid(nodes)...)
+		def.refs = append(def.refs, refs...)
+		return
+	}
+	defs[name] = &definition{source: source, nodes: parseValid(nodes), refs: append([]string(nil), refs...)}
+}
+
+//parseValid parses the nodes of raw which are valid
+func parseValid(raw []string) perms.Nodes {
+	nodes := make(perms.Nodes, 0, len(raw))
+	for _, nodeStr := range raw {
+		if node, err := perms.ParseNode(nodeStr); err == nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func (l *linter) report(source int, path string, check string, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{
+		File:    l.sources[source].File,
+		Path:    path,
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lintSource(i int, source Source) {
+	names := make([]string, 0, len(source.PConf.Groups))
+	for name := range source.PConf.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g := source.PConf.Groups[name]
+		if l.overwritten(i, "groups", name, l.groups[name]) {
+			continue
+		}
+		if name != "default" && !l.referenced(name) {
+			l.report(i, path("groups", name), CheckUnusedGroup, "group %q is never referenced", name)
+		}
+		for j, parent := range g.Parents {
+			if l.groups[parent] == nil {
+				l.report(i, path("groups", name, "parents", j), CheckUndefinedGroup, "parent %q is not defined", parent)
+			}
+		}
+		l.lintNodes(i, "groups", name, g.Nodes, l.groupGrants(), contains(l.config.BroadGroups, name))
+	}
+
+	names = names[:0]
+	for name := range source.PConf.Users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		u := source.PConf.Users[name]
+		if l.overwritten(i, "users", name, l.users[name]) {
+			continue
+		}
+		for j, group := range u.Groups {
+			if l.groups[group] == nil {
+				l.report(i, path("users", name, "groups", j), CheckUndefinedGroup, "group %q is not defined", group)
+			}
+		}
+		l.lintNodes(i, "users", name, u.Nodes, l.userGrants(name), contains(l.config.BroadUsers, name))
+	}
+}
+
+//overwritten reports the user or group if a later source replaces it or, under MergeError, declares it again
+func (l *linter) overwritten(source int, kind string, name string, def *definition) bool {
+	if def.source == source || l.config.Merge == perms.MergeAppend {
+		return false
+	}
+	if l.config.Merge == perms.MergeError {
+		l.report(source, path(kind, name), CheckOverwritten, "%v %q is declared again by %v", kind[:len(kind)-1], name, l.sources[def.source].File)
+	} else {
+		l.report(source, path(kind, name), CheckOverwritten, "%v %q is overwritten by %v", kind[:len(kind)-1], name, l.sources[def.source].File)
+	}
+	return true
+}
+
+//referenced checks if any user or group references group
+func (l *linter) referenced(group string) bool {
+	for _, defs := range []map[string]*definition{l.users, l.groups} {
+		for _, def := range defs {
+			for _, ref := range def.refs {
+				if ref == group {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+//contains checks if name is in allowed
+func contains(allowed []string, name string) bool {
+	for _, a := range allowed {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+//grants returns the grants of nodes
+func grants(nodes perms.Nodes) perms.Nodes {
+	out := make(perms.Nodes, 0, len(nodes))
+	for _, n := range nodes {
+		if !n.Negate {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+//groupGrants returns everything any group grants.
+//A negation in a group overrides the grants of every other group of a user.
+func (l *linter) groupGrants() perms.Nodes {
+	var out perms.Nodes
+	for _, def := range l.groups {
+		out = append(out, grants(def.nodes)...)
+	}
+	return out
+}
+
+//userGrants returns everything a user could be granted by itself, its groups and the default group
+func (l *linter) userGrants(name string) perms.Nodes {
+	user := l.users[name]
+	out := grants(user.nodes)
+	for _, group := range append([]string{"default"}, user.refs...) {
+		if def := l.groups[group]; def != nil {
+			out = append(out, grants(def.nodes)...)
+		}
+	}
+	return out
+}
+
+//lintNodes checks the nodes of a user or group.
+//reachable are the grants its negations could negate.
+func (l *linter) lintNodes(source int, kind string, name string, raw []string, reachable perms.Nodes, allowBroad bool) {
+	type indexed struct {
+		index   int
+		check   string
+		message string
+	}
+	var found []indexed
+
+	nodes := make(perms.Nodes, 0, len(raw))
+	//indexes holds the position in raw of each parsed node
+	indexes := make([]int, 0, len(raw))
+	for j, nodeStr := range raw {
+		node, err := perms.ParseNode(nodeStr)
+		if err != nil {
+			found = append(found, indexed{j, CheckInvalidNode, fmt.Sprintf("%q: %v", nodeStr, err)})
+			continue
+		}
+		nodes = append(nodes, node)
+		indexes = append(indexes, j)
+	}
+
+	for j, node := range nodes {
+		if !node.Negate && !allowBroad && isBroad(node) {
+			found = append(found, indexed{indexes[j], CheckBroad, fmt.Sprintf("%v grants every permission", node)})
+		}
+		if node.Negate && !reachable.Overlaps(node) {
+			found = append(found, indexed{indexes[j], CheckUselessNegation, fmt.Sprintf("%v negates nothing", node)})
+		}
+		if l.config.Registry != nil && !l.config.Registry.Overlaps(node) {
+			found = append(found, indexed{indexes[j], CheckUnknownNode, fmt.Sprintf("%v matches no registered permission", node)})
+		}
+	}
+
+	_, removals := nodes.Simplify()
+	for _, r := range removals {
+		index := indexes[r.Index]
+		switch r.Reason {
+		case perms.ReasonDuplicate:
+			found = append(found, indexed{index, CheckDuplicate, fmt.Sprintf("%v is repeated", r.Node)})
+		case perms.ReasonNegated:
+			found = append(found, indexed{index, CheckShadowed, r.String()})
+		case perms.ReasonCovered:
+			//a negation which only takes away what the other grants of the list lose anyway
+			//may still deny grants from other users and groups, unless another negation covers it
+			if r.Node.Negate && !(len(r.By) == 1 && perms.Covers(r.By[0], r.Node)) {
+				continue
+			}
+			found = append(found, indexed{index, CheckRedundant, r.String()})
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].index < found[j].index
+	})
+	for _, f := range found {
+		l.report(source, path(kind, name, "nodes", f.index), f.check, "%v", f.message)
+	}
+}
+
+//isBroad checks if node matches every permission
+func isBroad(node perms.Node) bool {
+	return len(node.Parts) == 1 && node.Parts[0] == perms.WildcardSelector
+}
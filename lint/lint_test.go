@@ -0,0 +1,146 @@
+package lint_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stratexio/perms"
+	"github.com/stratexio/perms/lint"
+)
+
+func TestLint(t *testing.T) {
+	//ParsePConf would reject the invalid node, so decode without validating
+	base := new(perms.PConf)
+	err := json.Unmarshal([]byte(`{
+		"groups": {
+			"default": {"nodes": ["profile.use"]},
+			"admin": {"nodes": ["*"]},
+			"manager": {
+				"parents": ["project_lead"],
+				"nodes": ["projects.*", "projects.webserver.build", "projects.*", "-billing.*", "bad node"]
+			},
+			"unused": {"nodes": ["analytics.view", "-analytics.*"]}
+		},
+		"users": {
+			"ammar": {"groups": ["manager", "admin"], "nodes": ["-projects.*.chat.moderate"]},
+			"bob": {"groups": ["managre"], "nodes": ["*", "-reports.*"]}
+		}
+	}`), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := perms.MustParsePConf([]byte(`{
+		"users": {
+			"bob": {"groups": ["manager"], "nodes": ["projects.webserver.biuld", "-reports.*"]}
+		}
+	}`))
+
+	registry := perms.NewRegistry()
+	registry.MustRegister(
+		perms.Permission{Node: perms.MustParseNode("projects.*.build")},
+		perms.Permission{Node: perms.MustParseNode("projects.*.chat.*")},
+		perms.Permission{Node: perms.MustParseNode("profile.use")},
+	)
+
+	findings := lint.Lint([]lint.Source{
+		{File: "base.json", PConf: base},
+		{File: "overlay.json", PConf: overlay},
+	}, lint.Config{BroadGroups: []string{"admin"}, Registry: registry})
+
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.String())
+	}
+
+	want := []string{
+		`base.json: $.groups.manager.parents[0]: parent "project_lead" is not defined (undefined-group)`,
+		`base.json: $.groups.manager.nodes[1]: projects.webserver.build: covered by projects.* (redundant)`,
+		`base.json: $.groups.manager.nodes[2]: projects.* is repeated (duplicate)`,
+		`base.json: $.groups.manager.nodes[3]: -billing.* matches no registered permission (unknown-node)`,
+		`base.json: $.groups.manager.nodes[4]: "bad node": an illegal whitespace is present (invalid-node)`,
+		`base.json: $.groups.unused: group "unused" is never referenced (unused-group)`,
+		`base.json: $.groups.unused.nodes[0]: analytics.view matches no registered permission (unknown-node)`,
+		`base.json: $.groups.unused.nodes[0]: analytics.view: negated by -analytics.* (shadowed)`,
+		`base.json: $.groups.unused.nodes[1]: -analytics.* matches no registered permission (unknown-node)`,
+		`base.json: $.users.bob: user "bob" is overwritten by overlay.json (overwritten)`,
+		`overlay.json: $.users.bob.nodes[0]: projects.webserver.biuld matches no registered permission (unknown-node)`,
+		`overlay.json: $.users.bob.nodes[1]: -reports.* negates nothing (useless-negation)`,
+		`overlay.json: $.users.bob.nodes[1]: -reports.* matches no registered permission (unknown-node)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Lint() =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLint_Broad(t *testing.T) {
+	pconf := perms.MustParsePConf([]byte(`{"users": {"root": {"nodes": ["*"]}}}`))
+
+	findings := lint.Lint([]lint.Source{{File: "a.json", PConf: pconf}}, lint.Config{})
+	if len(findings) != 1 || findings[0].Check != lint.CheckBroad || findings[0].Path != "$.users.root.nodes[0]" {
+		t.Errorf("Lint() = %v", findings)
+	}
+
+	findings = lint.Lint([]lint.Source{{File: "a.json", PConf: pconf}}, lint.Config{BroadUsers: []string{"root"}})
+	if len(findings) != 0 {
+		t.Errorf("Lint() = %v", findings)
+	}
+}
+
+func TestLint_Merge(t *testing.T) {
+	sources := []lint.Source{
+		{File: "base.json", PConf: perms.MustParsePConf([]byte(`{"groups": {"manager": {"nodes": ["projects.*"]}}, "users": {"bob": {"groups": ["manager"]}}}`))},
+		{File: "overlay.json", PConf: perms.MustParsePConf([]byte(`{"users": {"bob": {"nodes": ["-projects.secret.*"]}}}`))},
+	}
+
+	tests := []struct {
+		merge perms.MergeStrategy
+		want  []string
+	}{
+		{perms.MergeReplace, []string{
+			`base.json: $.groups.manager: group "manager" is never referenced (unused-group)`,
+			`base.json: $.users.bob: user "bob" is overwritten by overlay.json (overwritten)`,
+			`overlay.json: $.users.bob.nodes[0]: -projects.secret.* negates nothing (useless-negation)`,
+		}},
+		//bob keeps manager, whose grants the negation negates
+		{perms.MergeAppend, nil},
+		{perms.MergeError, []string{
+			`base.json: $.groups.manager: group "manager" is never referenced (unused-group)`,
+			`base.json: $.users.bob: user "bob" is declared again by overlay.json (overwritten)`,
+			`overlay.json: $.users.bob.nodes[0]: -projects.secret.* negates nothing (useless-negation)`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.merge.String(), func(t *testing.T) {
+			var got []string
+			for _, f := range lint.Lint(sources, lint.Config{Merge: tt.merge}) {
+				got = append(got, f.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Lint() =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestLint_RedundantNegation(t *testing.T) {
+	pconf := perms.MustParsePConf([]byte(`{
+		"groups": {
+			"dev": {"nodes": ["projects.a.*", "-projects.*.b", "-projects.a.b", "-projects.*.c.*", "-projects.a.c.d"]},
+			"ops": {"nodes": ["projects.c.*"]}
+		},
+		"users": {"u": {"groups": ["dev", "ops"]}}
+	}`))
+
+	var got []string
+	for _, f := range lint.Lint([]lint.Source{{File: "a.json", PConf: pconf}}, lint.Config{}) {
+		if f.Check == lint.CheckRedundant {
+			got = append(got, f.String())
+		}
+	}
+	//-projects.*.b also denies projects.c.b granted by ops, while -projects.*.c.* covers -projects.a.c.d
+	want := []string{`a.json: $.groups.dev.nodes[4]: -projects.a.c.d: covered by -projects.*.c.* (redundant)`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Lint() =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
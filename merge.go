@@ -0,0 +1,206 @@
+package perms
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+//ErrConflict is returned when a PConf declares a user or group which already exists
+//and the merge strategy is MergeError
+var ErrConflict = errors.New("declared more than once")
+
+//MergeStrategy controls what happens when a PConf declares a user or group which already exists
+type MergeStrategy int
+
+//merge strategies
+const (
+	//MergeReplace replaces the existing user or group
+	MergeReplace MergeStrategy = iota
+	//MergeAppend appends the nodes, parents and groups to the existing user or group,
+	//skipping the ones it already has
+	MergeAppend
+	//MergeError fails with ErrConflict
+	MergeError
+)
+
+//String returns the name of s
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeReplace:
+		return "replace"
+	case MergeAppend:
+		return "append"
+	case MergeError:
+		return "error"
+	}
+	return fmt.Sprintf("MergeStrategy(%d)", int(s))
+}
+
+//MergeStrategy returns the merge strategy of w
+func (w *Web) MergeStrategy() MergeStrategy {
+	return w.merge
+}
+
+//SetMergeStrategy sets how AddPConf treats users and groups which already exist.
+//It does not affect AddUser and AddGroup, which always replace.
+func (w *Web) SetMergeStrategy(s MergeStrategy) {
+	w.merge = s
+}
+
+//describeSource returns a description of where a PConf came from for errors
+func describeSource(source string) string {
+	if source == "" {
+		return "an unnamed pconf"
+	}
+	return source
+}
+
+//AddPConfFrom adds a PConf read from source, usually a file name, to the web.
+//source is used to report conflicts and audit events.
+//Nothing is added if an error is returned, unless it is a failure to record audit events,
+//though if w has a store, some of the users and groups may have been saved to it.
+func (w *Web) AddPConfFrom(source string, p *PConf) error {
+	groups := make([]*Group, 0, len(p.Groups))
+	for _, name := range p.groupNames() {
+		unprocessedGroup := p.Groups[name]
+		group := NewGroup(w.norm.Normalize(name))
+		for _, nodeStr := range unprocessedGroup.Nodes {
+			node, err := w.norm.ParseNode(nodeStr)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse node %q", nodeStr)
+			}
+			group.Nodes = append(group.Nodes, node)
+		}
+		group.Parents = w.norm.Names(unprocessedGroup.Parents)
+		groups = append(groups, group)
+	}
+
+	users := make([]*User, 0, len(p.Users))
+	for _, name := range p.userNames() {
+		unprocessedUser := p.Users[name]
+		user := NewUser(w.norm.Normalize(name))
+		for _, nodeStr := range unprocessedUser.Nodes {
+			node, err := w.norm.ParseNode(nodeStr)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse node %q", nodeStr)
+			}
+			user.Nodes = append(user.Nodes, node)
+		}
+		user.Groups = w.norm.Names(unprocessedUser.Groups)
+		users = append(users, user)
+	}
+
+	if w.merge == MergeError {
+		//names may also collide within p once normalized
+		seen := make(map[string]bool, len(groups)+len(users))
+		conflict := func(kind string, name string, exists bool, sources map[string]string) error {
+			if !exists && !seen[kind+name] {
+				seen[kind+name] = true
+				return nil
+			}
+			previous := describeSource(source)
+			if exists {
+				previous = describeSource(sources[name])
+			}
+			return errors.Wrapf(ErrConflict, "%v %q in %v is already declared in %v", kind, name, describeSource(source), previous)
+		}
+		for _, g := range groups {
+			if err := conflict("group", g.Name, w.groups[g.Name] != nil, w.groupSources); err != nil {
+				return err
+			}
+		}
+		for _, u := range users {
+			if err := conflict("user", u.Name, w.user(u.Name) != nil, w.userSources); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w.store != nil {
+		for _, group := range groups {
+			save := group
+			if existing := w.groups[group.Name]; existing != nil && w.merge == MergeAppend {
+				save = copyGroup(existing)
+				save.Parents = appendNames(save.Parents, group.Parents)
+				save.Nodes = appendNodes(save.Nodes, group.Nodes)
+			}
+			if err := w.store.SaveGroup(save); err != nil {
+				return err
+			}
+		}
+		for _, user := range users {
+			save := user
+			if existing := w.user(user.Name); existing != nil && w.merge == MergeAppend {
+				save = copyUser(existing)
+				save.Groups = appendNames(save.Groups, user.Groups)
+				save.Nodes = appendNodes(save.Nodes, user.Nodes)
+			}
+			if err := w.store.SaveUser(save); err != nil {
+				return err
+			}
+		}
+	}
+
+	var events []AuditEvent
+	tracking := w.tracking()
+	for _, group := range groups {
+		existing := w.groups[group.Name]
+		event := AuditEvent{Action: AuditAddPConf, Kind: "group", Name: group.Name, Source: source}
+		if tracking {
+			event.Before = w.groupState(group.Name)
+		}
+		if existing != nil && w.merge == MergeAppend {
+			existing.Parents = appendNames(existing.Parents, group.Parents)
+			existing.Nodes = appendNodes(existing.Nodes, group.Nodes)
+			group = existing
+		} else {
+			w.groups[group.Name] = group
+			w.groupSources[group.Name] = source
+		}
+		event.After = auditGroup(group)
+		w.groupStates[group.Name] = event.After
+		if tracking {
+			events = append(events, event)
+		}
+	}
+	for _, user := range users {
+		existing := w.user(user.Name)
+		event := AuditEvent{Action: AuditAddPConf, Kind: "user", Name: user.Name, Source: source}
+		if tracking {
+			event.Before = w.userState(user.Name)
+		}
+		if existing != nil && w.merge == MergeAppend {
+			existing.Groups = appendNames(existing.Groups, user.Groups)
+			existing.Nodes = appendNodes(existing.Nodes, user.Nodes)
+			user = existing
+		} else {
+			w.users[user.Name] = user
+			w.userSources[user.Name] = source
+		}
+		event.After = auditUser(user)
+		w.userStates[user.Name] = event.After
+		if tracking {
+			events = append(events, event)
+		}
+	}
+	return w.commit(events...)
+}
+
+//appendNames appends the names in add which are not in names
+func appendNames(names []string, add []string) []string {
+	for _, name := range add {
+		if len(difference([]string{name}, names)) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+//appendNodes appends the nodes in add which are not in ns
+func appendNodes(ns Nodes, add Nodes) Nodes {
+	for _, n := range add {
+		ns = appendUnique(ns, n)
+	}
+	return ns
+}
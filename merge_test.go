@@ -0,0 +1,86 @@
+package perms
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	mergeBase    = `{"groups": {"manager": {"nodes": ["projects.*"]}}, "users": {"ammar": {"groups": ["manager"]}}}`
+	mergeOverlay = `{"groups": {"manager": {"parents": ["project_lead"], "nodes": ["projects.*", "-projects.secret.*"]}}}`
+)
+
+func TestWeb_AddPConfFrom(t *testing.T) {
+	tests := []struct {
+		strategy MergeStrategy
+		parents  []string
+		nodes    []string
+	}{
+		{MergeReplace, []string{"project_lead"}, []string{"projects.*", "-projects.secret.*"}},
+		{MergeAppend, []string{"project_lead"}, []string{"projects.*", "-projects.secret.*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy.String(), func(t *testing.T) {
+			web := NewWeb()
+			web.SetMergeStrategy(tt.strategy)
+			if err := web.AddPConfFrom("base.json", MustParsePConf([]byte(mergeBase))); err != nil {
+				t.Fatal(err)
+			}
+			if err := web.AddPConfFrom("overlay.json", MustParsePConf([]byte(mergeOverlay))); err != nil {
+				t.Fatal(err)
+			}
+			manager := web.GetGroup("manager")
+			if !reflect.DeepEqual(manager.Parents, tt.parents) || !reflect.DeepEqual(manager.Nodes.Strings(), tt.nodes) {
+				t.Errorf("manager = %v %v, want %v %v", manager.Parents, manager.Nodes.Strings(), tt.parents, tt.nodes)
+			}
+		})
+	}
+}
+
+func TestWeb_AddPConfFrom_Append(t *testing.T) {
+	web := NewWeb()
+	web.SetMergeStrategy(MergeAppend)
+	web.AddPConf(MustParsePConf([]byte(`{"users": {"ammar": {"groups": ["manager"], "nodes": ["a.b"]}}}`)))
+	web.AddPConf(MustParsePConf([]byte(`{"users": {"ammar": {"groups": ["admin", "manager"], "nodes": ["a.b", "-a.c"]}}}`)))
+
+	ammar := web.GetUser("ammar")
+	if want := []string{"manager", "admin"}; !reflect.DeepEqual(ammar.Groups, want) {
+		t.Errorf("Groups = %v, want %v", ammar.Groups, want)
+	}
+	if want := []string{"a.b", "-a.c"}; !reflect.DeepEqual(ammar.Nodes.Strings(), want) {
+		t.Errorf("Nodes = %v, want %v", ammar.Nodes.Strings(), want)
+	}
+}
+
+func TestWeb_AddPConfFrom_Error(t *testing.T) {
+	web := NewWeb()
+	web.SetMergeStrategy(MergeError)
+	if err := web.AddPConfFrom("base.json", MustParsePConf([]byte(mergeBase))); err != nil {
+		t.Fatal(err)
+	}
+
+	err := web.AddPConfFrom("overlay.json", MustParsePConf([]byte(mergeOverlay)))
+	if errors.Cause(err) != ErrConflict {
+		t.Fatalf("AddPConfFrom() = %v, want ErrConflict", err)
+	}
+	want := `group "manager" in overlay.json is already declared in base.json: declared more than once`
+	if err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+	if len(web.GetGroup("manager").Nodes) != 1 {
+		t.Errorf("a conflicting pconf was partially added")
+	}
+
+	//names can collide within a pconf once normalized
+	web = NewWeb()
+	web.SetMergeStrategy(MergeError)
+	if err := web.SetNormalization(Normalization{FoldCase: true}); err != nil {
+		t.Fatal(err)
+	}
+	err = web.AddPConfFrom("users.json", MustParsePConf([]byte(`{"users": {"Bob": {}, "bob": {}}}`)))
+	if errors.Cause(err) != ErrConflict {
+		t.Errorf("AddPConfFrom() = %v, want ErrConflict", err)
+	}
+}
@@ -1,7 +1,6 @@
 package perms
 
 import (
-	"bytes"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -91,17 +90,97 @@ func (n Node) Match(check Node) bool {
 	return !(len(check.Parts) < len(n.Parts))
 }
 
+//validNodeString checks if ParseNode would accept raw
+func validNodeString(raw string) bool {
+	return len(raw) > 0 && !strings.HasPrefix(raw, PartSeperator) && !whitespace.Contains(raw)
+}
+
+//MatchString checks if a node matches the node check would parse to.
+//It does not allocate. Unparseable checks never match.
+//it is unaware of negation.
+func (n Node) MatchString(check string) bool {
+	if !validNodeString(check) {
+		return false
+	}
+	return n.matchString(check)
+}
+
+//matchString is MatchString for a check known to be valid
+func (n Node) matchString(check string) bool {
+	if check[0] == NegateSignifier {
+		check = check[1:]
+	}
+
+	var lastWildcard bool
+	var i int
+	for ; ; i++ {
+		end := strings.Index(check, PartSeperator)
+		namespace := check
+		if end >= 0 {
+			namespace = check[:end]
+		}
+
+		if len(n.Parts) == i {
+			return lastWildcard
+		}
+
+		if n.Parts[i] == WildcardSelector {
+			lastWildcard = true
+		} else {
+			lastWildcard = false
+			if namespace != n.Parts[i] {
+				return false
+			}
+		}
+
+		if end < 0 {
+			break
+		}
+		check = check[end+len(PartSeperator):]
+	}
+
+	return !(i+1 < len(n.Parts))
+}
+
 //String returns the string representation of the node
 func (n Node) String() string {
-	buf := new(bytes.Buffer)
+	if !n.Negate && len(n.Parts) == 1 {
+		return n.Parts[0]
+	}
+
+	size := len(n.Parts) - 1
 	if n.Negate {
-		buf.WriteByte('-')
+		size++
+	}
+	for _, namespace := range n.Parts {
+		size += len(namespace)
+	}
+
+	var buf strings.Builder
+	buf.Grow(size)
+	if n.Negate {
+		buf.WriteByte(NegateSignifier)
 	}
 	for i, namespace := range n.Parts {
 		buf.WriteString(namespace)
 		if i != (len(n.Parts) - 1) {
-			buf.WriteByte('.')
+			buf.WriteString(PartSeperator)
 		}
 	}
 	return buf.String()
 }
+
+//MarshalText implements the text marshaller interface
+func (n Node) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+//UnmarshalText implements the text unmarshaller interface
+func (n *Node) UnmarshalText(text []byte) error {
+	node, err := ParseNode(string(text))
+	if err != nil {
+		return err
+	}
+	*n = node
+	return nil
+}
@@ -45,3 +45,19 @@ func BenchmarkNode_String(b *testing.B) {
 		node.String()
 	}
 }
+
+func BenchmarkNode_MatchString(b *testing.B) {
+	node := MustParseNode("webserver.*.use")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		node.MatchString("webserver.fun.use")
+	}
+}
+
+func BenchmarkInterner_Parse(b *testing.B) {
+	in := NewInterner(0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in.MustParse("pretty.generic.node")
+	}
+}
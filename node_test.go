@@ -3,6 +3,7 @@ package perms
 import (
 	"reflect"
 	"testing"
+	"testing/quick"
 )
 
 func TestParseNode(t *testing.T) {
@@ -81,6 +82,7 @@ func TestNode_String(t *testing.T) {
 		{"simple", fields{Namespaces: []string{"projects", "backend"}}, "projects.backend"},
 		{"supernode", fields{Namespaces: []string{"*"}}, "*"},
 		{"negate", fields{Namespaces: []string{"billing", "*"}, Negate: true}, "-billing.*"},
+		{"negate_single", fields{Namespaces: []string{"billing"}, Negate: true}, "-billing"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -94,3 +96,54 @@ func TestNode_String(t *testing.T) {
 		})
 	}
 }
+
+func TestNode_MatchString(t *testing.T) {
+	checks := []string{
+		"projects", "projects.webserver", "projects.frontend", "projects.test.chat",
+		"projects.test.test", "billing.frontend", "-projects.webserver", "projects.*",
+		"a.b.c.d", "", ".projects", "projects. webserver", "-",
+	}
+	nodes := []string{"projects.webserver", "projects.*", "projects.*.chat", "*", "a.*.c", "a.b.*"}
+
+	for _, raw := range nodes {
+		node := MustParseNode(raw)
+		for _, check := range checks {
+			want := false
+			if parsed, err := ParseNode(check); err == nil {
+				want = node.Match(parsed)
+			}
+			if got := node.MatchString(check); got != want {
+				t.Errorf("%q.MatchString(%q) = %v, want %v", raw, check, got, want)
+			}
+		}
+	}
+
+	property := func(n, check quickNode) bool {
+		return Node(n).MatchString(Node(check).String()) == Node(n).Match(Node(check))
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+
+	node := MustParseNode("projects.*.chat.use")
+	allocs := testing.AllocsPerRun(100, func() {
+		node.MatchString("projects.webserver.chat.use")
+	})
+	if allocs != 0 {
+		t.Errorf("MatchString allocated %v times", allocs)
+	}
+}
+
+func TestNode_Text(t *testing.T) {
+	var n Node
+	if err := n.UnmarshalText([]byte("-projects.*")); err != nil {
+		t.Fatalf("UnmarshalText() error = %v", err)
+	}
+	text, err := n.MarshalText()
+	if err != nil || string(text) != "-projects.*" {
+		t.Errorf("MarshalText() = %s, %v", text, err)
+	}
+	if err := n.UnmarshalText([]byte("bad node")); err == nil {
+		t.Errorf("UnmarshalText() should fail on whitespace")
+	}
+}
@@ -70,6 +70,23 @@ func (ns Nodes) Check(check Node) (matched bool, negated bool) {
 	return matched, false
 }
 
+//CheckString checks for a permission with ns without parsing check.
+//It does not allocate. Unparseable checks are never matched.
+func (ns Nodes) CheckString(check string) (matched bool, negated bool) {
+	if !validNodeString(check) {
+		return false, false
+	}
+	for _, node := range ns {
+		if node.matchString(check) {
+			matched = true
+			if node.Negate {
+				return true, true
+			}
+		}
+	}
+	return matched, false
+}
+
 //String returns a string representation of n
 func (ns Nodes) String() string {
 	if ns == nil {
@@ -3,6 +3,7 @@ package perms
 import (
 	"bytes"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -135,3 +136,25 @@ func TestNodes_SQL(t *testing.T) {
 		t.Fatalf("Value should return the same string as Scan input, got %s", vstr)
 	}
 }
+
+func TestNodes_CheckString(t *testing.T) {
+	ns := MustParseNodes(strings.NewReader("projects.* -projects.*.chat.moderate billing.view"))
+
+	for _, check := range []string{"projects.webserver.build", "projects.webserver.chat.moderate", "billing.view", "billing.edit", "bad check"} {
+		wantMatched, wantNegated := false, false
+		if node, err := ParseNode(check); err == nil {
+			wantMatched, wantNegated = ns.Check(node)
+		}
+		matched, negated := ns.CheckString(check)
+		if matched != wantMatched || negated != wantNegated {
+			t.Errorf("CheckString(%q) = %v, %v, want %v, %v", check, matched, negated, wantMatched, wantNegated)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ns.CheckString("projects.webserver.chat.moderate")
+	})
+	if allocs != 0 {
+		t.Errorf("CheckString allocated %v times", allocs)
+	}
+}
@@ -0,0 +1,110 @@
+package perms
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+//Normalization controls how namespaces and user and group names are compared.
+//The zero value compares strings exactly.
+type Normalization struct {
+	//FoldCase makes comparisons case insensitive
+	FoldCase bool
+	//NFC converts strings to Unicode Normalization Form C so that
+	//composed and decomposed forms of the same text are equal
+	NFC bool
+}
+
+//isASCII checks if str only contains ASCII characters
+func isASCII(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+//Normalize returns the normalized form of str
+func (nz Normalization) Normalize(str string) string {
+	if isASCII(str) {
+		if nz.FoldCase {
+			return asciiLower(str)
+		}
+		return str
+	}
+
+	if nz.NFC {
+		str = norm.NFC.String(str)
+	}
+	if nz.FoldCase {
+		str = cases.Fold().String(str)
+		if nz.NFC {
+			str = norm.NFC.String(str)
+		}
+	}
+	return str
+}
+
+//asciiLower lower cases str without allocating if it is already lower case
+func asciiLower(str string) string {
+	for i := 0; i < len(str); i++ {
+		if 'A' <= str[i] && str[i] <= 'Z' {
+			b := []byte(str)
+			for j := i; j < len(b); j++ {
+				if 'A' <= b[j] && b[j] <= 'Z' {
+					b[j] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return str
+}
+
+//Node returns a normalized copy of n
+func (nz Normalization) Node(n Node) Node {
+	if nz == (Normalization{}) {
+		return n
+	}
+	parts := make([]string, len(n.Parts))
+	for i, part := range n.Parts {
+		parts[i] = nz.Normalize(part)
+	}
+	return Node{Parts: parts, Negate: n.Negate}
+}
+
+//Nodes returns a normalized copy of ns
+func (nz Normalization) Nodes(ns Nodes) Nodes {
+	if nz == (Normalization{}) || ns == nil {
+		return ns
+	}
+	out := make(Nodes, len(ns))
+	for i, n := range ns {
+		out[i] = nz.Node(n)
+	}
+	return out
+}
+
+//Names returns a normalized copy of names
+func (nz Normalization) Names(names []string) []string {
+	if nz == (Normalization{}) || names == nil {
+		return names
+	}
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = nz.Normalize(name)
+	}
+	return out
+}
+
+//ParseNode parses a permission node and normalizes it
+func (nz Normalization) ParseNode(raw string) (Node, error) {
+	return ParseNode(nz.Normalize(raw))
+}
+
+//Match checks if n matches check once both are normalized.
+//it is unaware of negation.
+func (nz Normalization) Match(n Node, check Node) bool {
+	return nz.Node(n).Match(nz.Node(check))
+}
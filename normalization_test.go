@@ -0,0 +1,123 @@
+package perms
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNormalization_Normalize(t *testing.T) {
+	tests := []struct {
+		name string
+		nz   Normalization
+		str  string
+		want string
+	}{
+		{"exact", Normalization{}, "Projects", "Projects"},
+		{"fold", Normalization{FoldCase: true}, "PROJECTS", "projects"},
+		{"fold_lower", Normalization{FoldCase: true}, "projects", "projects"},
+		{"fold_unicode", Normalization{FoldCase: true}, "STRASSE", "strasse"},
+		{"nfc", Normalization{NFC: true}, "cafe\u0301", "caf\u00e9"},
+		{"nfc_fold", Normalization{FoldCase: true, NFC: true}, "CAFE\u0301", "caf\u00e9"},
+		{"no_nfc", Normalization{}, "cafe\u0301", "cafe\u0301"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.nz.Normalize(tt.str); got != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalization_Match(t *testing.T) {
+	nz := Normalization{FoldCase: true, NFC: true}
+	if !nz.Match(MustParseNode("Projects.*"), MustParseNode("PROJECTS.cafe\u0301.use")) {
+		t.Errorf("normalized nodes should match")
+	}
+	if (Normalization{}).Match(MustParseNode("Projects.*"), MustParseNode("projects.build")) {
+		t.Errorf("nodes are case sensitive by default")
+	}
+}
+
+func TestWeb_Normalization(t *testing.T) {
+	web := NewWeb()
+	pconf := MustParsePConf([]byte(`{
+		"groups": {
+			"Admin": {
+				"nodes": ["Billing.*"]
+			}
+		},
+		"users": {
+			"Ammar": {
+				"groups": ["ADMIN"],
+				"nodes": ["projects.caf\u00e9.use"]
+			}
+		}
+	}`))
+	if err := web.AddPConf(pconf); err != nil {
+		t.Fatalf("err while adding pconf: %v", err)
+	}
+
+	if web.CheckUserHasPermission("ammar", MustParseNode("billing.manage")) {
+		t.Errorf("ammar should not be found without normalization")
+	}
+
+	if err := web.SetNormalization(Normalization{FoldCase: true, NFC: true}); err != nil {
+		t.Fatalf("err while setting normalization: %v", err)
+	}
+
+	if web.GetUser("AMMAR") == nil || web.GetGroup("admin") == nil {
+		t.Fatalf("user and group lookups should be normalized")
+	}
+	if !web.CheckUserHasPermission("ammar", MustParseNode("BILLING.manage")) {
+		t.Errorf("ammar should have billing.manage")
+	}
+	if !web.CheckUserHasPermission("AMMAR", MustParseNode("projects.cafe\u0301.use")) {
+		t.Errorf("ammar should have the decomposed node")
+	}
+
+	web.AddUser(&User{Name: "Bob", Groups: []string{"Admin"}})
+	if !web.CheckUserHasPermission("bob", MustParseNode("billing.manage")) {
+		t.Errorf("bob should have billing.manage")
+	}
+	web.DelUser("BOB")
+	if web.GetUser("bob") != nil {
+		t.Errorf("bob should be deleted")
+	}
+}
+
+func TestWeb_SetNormalization_Failure(t *testing.T) {
+	web, store := NewWeb(), NewMemoryStore()
+	web.SetStore(store)
+	web.AddUser(&User{Name: "Ammar"})
+	web.AddUser(&User{Name: "ammar"})
+	web.SetMergeStrategy(MergeError)
+	var events []Event
+	web.Subscribe(func(e Event) { events = append(events, e) })
+
+	if err := web.SetNormalization(Normalization{FoldCase: true}); errors.Cause(err) != ErrConflict {
+		t.Fatalf("SetNormalization() = %v, want ErrConflict", err)
+	}
+	if web.Normalization() != (Normalization{}) || len(web.UserNames()) != 2 {
+		t.Errorf("a failed SetNormalization() changed the web to %v", web.UserNames())
+	}
+	if users, _ := store.UserNames(); len(users) != 2 {
+		t.Errorf("a failed SetNormalization() changed the store to %v", users)
+	}
+	if len(events) != 0 {
+		t.Errorf("a failed SetNormalization() published %+v", events)
+	}
+
+	web.SetMergeStrategy(MergeReplace)
+	if err := web.SetNormalization(Normalization{FoldCase: true}); err != nil {
+		t.Fatal(err)
+	}
+	if users, _ := store.UserNames(); !reflect.DeepEqual(users, []string{"ammar"}) {
+		t.Errorf("store users = %v, want [ammar]", users)
+	}
+	if len(events) != 1 || events[0].Type != ConfigReloaded {
+		t.Errorf("events = %+v, want ConfigReloaded", events)
+	}
+}
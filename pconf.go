@@ -2,24 +2,26 @@ package perms
 
 import (
 	"encoding/json"
-
-	"github.com/pkg/errors"
+	"sort"
 )
 
 type pconfGroup struct {
-	Parents []string `json:"parents"`
-	Nodes   []string `json:"nodes"`
+	Parents []string `json:"parents" yaml:"parents,omitempty" toml:"parents,omitempty"`
+	Nodes   []string `json:"nodes" yaml:"nodes,omitempty" toml:"nodes,omitempty" schema:"node"`
 }
 
 type pconfUser struct {
-	Groups []string `json:"groups"`
-	Nodes  []string `json:"nodes"`
+	Groups []string `json:"groups" yaml:"groups,omitempty" toml:"groups,omitempty"`
+	Nodes  []string `json:"nodes" yaml:"nodes,omitempty" toml:"nodes,omitempty" schema:"node"`
 }
 
 //PConf contains a permissions config
 type PConf struct {
-	Groups map[string]pconfGroup `json:"groups"`
-	Users  map[string]pconfUser  `json:"users"`
+	//Include lists files or globs to load before this PConf, see ReadPConfFile.
+	//AddPConf ignores it.
+	Include []string              `json:"include,omitempty" yaml:"include,omitempty" toml:"include,omitempty"`
+	Groups  map[string]pconfGroup `json:"groups" yaml:"groups" toml:"groups"`
+	Users   map[string]pconfUser  `json:"users" yaml:"users" toml:"users"`
 }
 
 //newPConf returns an instantiated pconf
@@ -30,6 +32,26 @@ func newPConf() *PConf {
 	return pc
 }
 
+//groupNames returns the names of the groups in pc in order
+func (pc *PConf) groupNames() []string {
+	names := make([]string, 0, len(pc.Groups))
+	for name := range pc.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//userNames returns the names of the users in pc in order
+func (pc *PConf) userNames() []string {
+	names := make([]string, 0, len(pc.Users))
+	for name := range pc.Users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 //Marshal generates the marshalled version of the pconf
 func (pc *PConf) Marshal() ([]byte, error) {
 	return json.Marshal(pc)
@@ -40,13 +62,10 @@ func (pc *PConf) PrettyMarshal() ([]byte, error) {
 	return json.MarshalIndent(pc, "", "    ")
 }
 
-//ParsePConf parses a pconf
+//ParsePConf parses a JSON pconf.
+//Use ParsePConfFormat for other formats.
 func ParsePConf(byt []byte) (*PConf, error) {
-	var pconf PConf
-	if err := json.Unmarshal(byt, &pconf); err != nil {
-		return nil, errors.Wrap(err, "failed to decode")
-	}
-	return &pconf, nil
+	return ParsePConfFormat(byt, FormatJSON)
 }
 
 //MustParsePConf parses the conf or panics trying
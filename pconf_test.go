@@ -43,3 +43,12 @@ func TestParsePConf(t *testing.T) {
 		t.Fatalf("Parse failed: pconf: %v", pconf)
 	}
 }
+
+func TestPConf_Marshal(t *testing.T) {
+	//every key of a group or user is written, even when its list is empty
+	want := `{"groups":{"admin":{"parents":[],"nodes":[]}},"users":{"ammar":{"groups":[],"nodes":[]}}}`
+	byt, err := MustParsePConf([]byte(want)).Marshal()
+	if err != nil || string(byt) != want {
+		t.Errorf("Marshal() = %s, %v, want %s", byt, err, want)
+	}
+}
@@ -0,0 +1,312 @@
+package perms
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//common registry errors
+var (
+	ErrUnregistered      = errors.New("node is not registered")
+	ErrNegatedPermission = errors.New("registered permissions can not be negated")
+)
+
+//Permission describes a permission node an application checks.
+//Wildcards in Node stand for parameters, such as the project in `projects.*.build`.
+type Permission struct {
+	Node Node
+	//Params optionally names each wildcard in Node in order
+	Params      []string
+	Description string
+	//Service is the name of the service which checks the permission
+	Service string
+	//Default grants the permission to users who match no node for it at all
+	Default bool
+}
+
+//UnknownMode controls what happens when an unregistered node is checked
+type UnknownMode int
+
+//unknown modes
+const (
+	//UnknownIgnore checks unregistered nodes as usual
+	UnknownIgnore UnknownMode = iota
+	//UnknownWarn reports unregistered nodes and checks them as usual
+	UnknownWarn
+	//UnknownError reports unregistered nodes and denies them
+	UnknownError
+)
+
+//Registry contains the permissions an application checks.
+//It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	perms []Permission
+	mode  UnknownMode
+	//report is called with every unregistered check in UnknownWarn and UnknownError mode
+	report func(check Node, err error)
+}
+
+//NewRegistry returns an instantiated registry which ignores unregistered nodes
+func NewRegistry() *Registry {
+	return &Registry{
+		perms: make([]Permission, 0, 20),
+	}
+}
+
+//SetMode sets how r treats checks of unregistered nodes.
+//report is called with each of them unless mode is UnknownIgnore. It may be nil.
+func (r *Registry) SetMode(mode UnknownMode, report func(check Node, err error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mode = mode
+	r.report = report
+}
+
+//Register adds permissions to r
+func (r *Registry) Register(perms ...Permission) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range perms {
+		if p.Node.Negate {
+			return errors.Wrapf(ErrNegatedPermission, "failed to register %v", p.Node)
+		}
+		if len(p.Params) > 0 && len(p.Params) != p.wildcards() {
+			return errors.Errorf("%v has %v wildcards but %v params", p.Node, p.wildcards(), len(p.Params))
+		}
+		str := p.Node.String()
+		for _, existing := range r.perms {
+			if existing.Node.String() == str {
+				return errors.Errorf("%v is already registered", str)
+			}
+		}
+		r.perms = append(r.perms, p)
+	}
+	return nil
+}
+
+//MustRegister registers perms or panics
+func (r *Registry) MustRegister(perms ...Permission) {
+	if err := r.Register(perms...); err != nil {
+		panic(err)
+	}
+}
+
+//wildcards returns the number of wildcards in p.Node
+func (p Permission) wildcards() int {
+	var n int
+	for _, part := range p.Node.Parts {
+		if part == WildcardSelector {
+			n++
+		}
+	}
+	return n
+}
+
+type registryPermission struct {
+	Node        string   `json:"node"`
+	Params      []string `json:"params,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Service     string   `json:"service,omitempty"`
+	Default     bool     `json:"default,omitempty"`
+}
+
+type registryFile struct {
+	Permissions []registryPermission `json:"permissions"`
+}
+
+//ParseRegistry parses a JSON registry file such as
+//	{"permissions": [{"node": "projects.*.build", "params": ["project"], "description": "Build a project"}]}
+func ParseRegistry(byt []byte) (*Registry, error) {
+	var file registryFile
+	if err := json.Unmarshal(byt, &file); err != nil {
+		return nil, errors.Wrap(err, "failed to decode")
+	}
+
+	r := NewRegistry()
+	for _, p := range file.Permissions {
+		node, err := ParseNode(p.Node)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse node %q", p.Node)
+		}
+		err = r.Register(Permission{
+			Node:        node,
+			Params:      p.Params,
+			Description: p.Description,
+			Service:     p.Service,
+			Default:     p.Default,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+//MustParseRegistry parses the registry or panics trying
+func MustParseRegistry(byt []byte) *Registry {
+	r, err := ParseRegistry(byt)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+//MarshalJSON marshals r into a registry file sorted by node
+func (r *Registry) MarshalJSON() ([]byte, error) {
+	file := registryFile{Permissions: []registryPermission{}}
+	for _, p := range r.Permissions() {
+		file.Permissions = append(file.Permissions, registryPermission{
+			Node:        p.Node.String(),
+			Params:      p.Params,
+			Description: p.Description,
+			Service:     p.Service,
+			Default:     p.Default,
+		})
+	}
+	return json.Marshal(file)
+}
+
+//Permissions returns every registered permission sorted by node
+func (r *Registry) Permissions() []Permission {
+	r.mu.RLock()
+	perms := make([]Permission, len(r.perms))
+	copy(perms, r.perms)
+	r.mu.RUnlock()
+
+	sort.Slice(perms, func(i, j int) bool {
+		return perms[i].Node.String() < perms[j].Node.String()
+	})
+	return perms
+}
+
+//Lookup returns the registered permission matching check
+func (r *Registry) Lookup(check Node) (Permission, bool) {
+	return r.lookup(check, Normalization{})
+}
+
+//lookup returns the registered permission matching check under nz
+func (r *Registry) lookup(check Node, nz Normalization) (Permission, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.perms {
+		if nz.Match(p.Node, check) {
+			return p, true
+		}
+	}
+	return Permission{}, false
+}
+
+//lookupString returns the registered permission matching check without allocating
+func (r *Registry) lookupString(check string) (Permission, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.perms {
+		if p.Node.matchString(check) {
+			return p, true
+		}
+	}
+	return Permission{}, false
+}
+
+//Validate returns ErrUnregistered if no registered permission matches check
+func (r *Registry) Validate(check Node) error {
+	if _, ok := r.Lookup(check); !ok {
+		return errors.Wrapf(ErrUnregistered, "%v", check)
+	}
+	return nil
+}
+
+//denies checks if r denies unregistered checks
+func (r *Registry) denies() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.mode == UnknownError
+}
+
+//allow reports an unregistered check unless r ignores them.
+//It returns false if the check should be denied.
+func (r *Registry) allow(known bool, check func() Node) bool {
+	if known {
+		return true
+	}
+
+	r.mu.RLock()
+	mode, report := r.mode, r.report
+	r.mu.RUnlock()
+
+	if mode == UnknownIgnore {
+		return true
+	}
+	if report != nil {
+		node := check()
+		report(node, errors.Wrapf(ErrUnregistered, "%v", node))
+	}
+	return mode != UnknownError
+}
+
+//UnknownNode is a node in a PConf that matches no registered permission,
+//which usually means it is misspelled
+type UnknownNode struct {
+	//Group is the group the node belongs to, if any
+	Group string
+	//User is the user the node belongs to, if any
+	User string
+	Node Node
+}
+
+//String returns a human readable description of u
+func (u UnknownNode) String() string {
+	if u.User != "" {
+		return fmt.Sprintf("user %q: %v matches no registered permission", u.User, u.Node)
+	}
+	return fmt.Sprintf("group %q: %v matches no registered permission", u.Group, u.Node)
+}
+
+//Overlaps checks if node could match at least one registered permission.
+//It is unaware of negation.
+func (r *Registry) Overlaps(node Node) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.perms {
+		if _, ok := intersect(node, p.Node); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//FindUnknown returns the nodes of pc that match no registered permission.
+//Groups come before users and both are sorted by name.
+func (r *Registry) FindUnknown(pc *PConf) ([]UnknownNode, error) {
+	var unknown []UnknownNode
+
+	check := func(group, user string, raw []string) error {
+		for _, nodeStr := range raw {
+			node, err := ParseNode(nodeStr)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse node %q", nodeStr)
+			}
+			if !r.Overlaps(node) {
+				unknown = append(unknown, UnknownNode{Group: group, User: user, Node: node})
+			}
+		}
+		return nil
+	}
+
+	for _, name := range pc.groupNames() {
+		if err := check(name, "", pc.Groups[name].Nodes); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range pc.userNames() {
+		if err := check("", name, pc.Users[name].Nodes); err != nil {
+			return nil, err
+		}
+	}
+	return unknown, nil
+}
@@ -0,0 +1,164 @@
+package perms
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func testRegistry() *Registry {
+	r := NewRegistry()
+	r.MustRegister(
+		Permission{Node: MustParseNode("projects.*.build"), Description: "Build a project", Service: "ci"},
+		Permission{Node: MustParseNode("projects.*.chat.use"), Description: "Use a project's chat", Service: "chat", Default: true},
+		Permission{Node: MustParseNode("billing.view"), Description: "View invoices", Service: "billing"},
+	)
+	return r
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := testRegistry()
+
+	if err := r.Register(Permission{Node: MustParseNode("billing.view")}); err == nil {
+		t.Errorf("registering a permission twice should fail")
+	}
+	if err := r.Register(Permission{Node: MustParseNode("-billing.edit")}); errors.Cause(err) != ErrNegatedPermission {
+		t.Errorf("Register() error = %v, want %v", err, ErrNegatedPermission)
+	}
+
+	perms := r.Permissions()
+	if len(perms) != 3 || perms[0].Node.String() != "billing.view" {
+		t.Errorf("Permissions() = %v", perms)
+	}
+
+	if p, ok := r.Lookup(MustParseNode("projects.webserver.build")); !ok || p.Service != "ci" {
+		t.Errorf("Lookup() = %v, %v", p, ok)
+	}
+	if err := r.Validate(MustParseNode("projects.webserver.biuld")); errors.Cause(err) != ErrUnregistered {
+		t.Errorf("Validate() error = %v, want %v", err, ErrUnregistered)
+	}
+}
+
+func TestWeb_Registry(t *testing.T) {
+	web := NewWeb()
+	web.AddUser(&User{Name: "ammar", Nodes: MustParseNodes(strings.NewReader("projects.* billing.* -projects.secret.chat.use"))})
+	web.AddUser(&User{Name: "bob"})
+
+	r := testRegistry()
+	web.SetRegistry(r)
+
+	var reported []string
+	report := func(check Node, err error) {
+		reported = append(reported, check.String())
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		if !web.CheckUserHasPermission("ammar", MustParseNode("projects.webserver.biuld")) {
+			t.Errorf("unregistered nodes should be checked as usual")
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		reported = nil
+		r.SetMode(UnknownWarn, report)
+		if !web.CheckUserHasPermission("ammar", MustParseNode("projects.webserver.biuld")) {
+			t.Errorf("unregistered nodes should be checked as usual")
+		}
+		if !web.CheckUserHasPermissionString("ammar", "billing.edit") {
+			t.Errorf("unregistered nodes should be checked as usual")
+		}
+		if !web.CheckUserHasPermission("ammar", MustParseNode("billing.view")) {
+			t.Errorf("ammar should have billing.view")
+		}
+		if strings.Join(reported, " ") != "projects.webserver.biuld billing.edit" {
+			t.Errorf("reported %v", reported)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		reported = nil
+		r.SetMode(UnknownError, report)
+		if web.CheckUserHasPermission("ammar", MustParseNode("projects.webserver.biuld")) {
+			t.Errorf("unregistered nodes should be denied")
+		}
+		if web.CheckUserHasPermissionString("ammar", "billing.edit") {
+			t.Errorf("unregistered nodes should be denied")
+		}
+		if len(reported) != 2 {
+			t.Errorf("reported %v", reported)
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		if !web.CheckUserHasPermission("bob", MustParseNode("projects.webserver.chat.use")) {
+			t.Errorf("bob should be granted projects.webserver.chat.use by default")
+		}
+		if !web.CheckUserHasPermissionString("bob", "projects.webserver.chat.use") {
+			t.Errorf("bob should be granted projects.webserver.chat.use by default")
+		}
+		if web.CheckUserHasPermission("bob", MustParseNode("projects.webserver.build")) {
+			t.Errorf("bob should not have projects.webserver.build")
+		}
+		if web.CheckUserHasPermission("ammar", MustParseNode("projects.secret.chat.use")) {
+			t.Errorf("negations should override default grants")
+		}
+	})
+}
+
+func TestRegistry_FindUnknown(t *testing.T) {
+	pconf := MustParsePConf([]byte(`{
+		"groups": {
+			"admin": {
+				"nodes": ["projects.*", "bililng.view"]
+			}
+		},
+		"users": {
+			"ammar": {
+				"nodes": ["projects.webserver.biuld", "-projects.*.chat.use"]
+			}
+		}
+	}`))
+
+	unknown, err := testRegistry().FindUnknown(pconf)
+	if err != nil {
+		t.Fatalf("FindUnknown() error = %v", err)
+	}
+
+	want := []string{
+		`group "admin": bililng.view matches no registered permission`,
+		`user "ammar": projects.webserver.biuld matches no registered permission`,
+	}
+	if len(unknown) != len(want) {
+		t.Fatalf("FindUnknown() = %v", unknown)
+	}
+	for i, u := range unknown {
+		if u.String() != want[i] {
+			t.Errorf("FindUnknown()[%v] = %q, want %q", i, u, want[i])
+		}
+	}
+}
+
+func TestParseRegistry(t *testing.T) {
+	byt := []byte(`{"permissions":[{"node":"billing.view","description":"View invoices","service":"billing"},{"node":"projects.*.build","params":["project"],"description":"Build a project","service":"ci"}]}`)
+
+	r, err := ParseRegistry(byt)
+	if err != nil {
+		t.Fatalf("ParseRegistry() error = %v", err)
+	}
+	if p, ok := r.Lookup(MustParseNode("projects.webserver.build")); !ok || p.Params[0] != "project" {
+		t.Errorf("Lookup() = %v, %v", p, ok)
+	}
+
+	js, err := r.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	if string(js) != string(byt) {
+		t.Errorf("MarshalJSON() = %s", js)
+	}
+
+	if _, err := ParseRegistry([]byte(`{"permissions":[{"node":"projects.*.build","params":["project","extra"]}]}`)); err == nil {
+		t.Errorf("params should match the wildcards of the node")
+	}
+}
@@ -0,0 +1,154 @@
+package perms
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+//ErrMissingUser is returned when renaming a user which does not exist
+var ErrMissingUser = errors.New("user does not exist")
+
+//ErrExists is returned when renaming a user or group to a name which is taken
+var ErrExists = errors.New("already exists")
+
+//ErrGroupInUse is returned when deleting a group which users or groups are in and the delete policy is DeleteRefuse
+var ErrGroupInUse = errors.New("group is in use")
+
+//DeletePolicy controls what DelGroup does with the users and groups in the deleted group
+type DeletePolicy int
+
+//delete policies
+const (
+	//DeleteKeep leaves the deleted group in the groups of users and the parents of groups
+	DeleteKeep DeletePolicy = iota
+	//DeleteCascade removes the deleted group from the groups of users and the parents of groups
+	DeleteCascade
+	//DeleteRefuse fails with ErrGroupInUse
+	DeleteRefuse
+)
+
+//String returns the name of p
+func (p DeletePolicy) String() string {
+	switch p {
+	case DeleteKeep:
+		return "keep"
+	case DeleteCascade:
+		return "cascade"
+	case DeleteRefuse:
+		return "refuse"
+	}
+	return fmt.Sprintf("DeletePolicy(%d)", int(p))
+}
+
+//DeletePolicy returns the delete policy of w
+func (w *Web) DeletePolicy() DeletePolicy {
+	return w.deletePolicy
+}
+
+//SetDeletePolicy sets what DelGroup does with the users and groups in the deleted group.
+//It does not affect Update, which never leaves users or groups in a deleted group.
+func (w *Web) SetDeletePolicy(p DeletePolicy) {
+	w.deletePolicy = p
+}
+
+//referrer describes the first user or group in the group with name, or returns "" if there is none
+func (w *Web) referrer(name string) string {
+	for _, other := range w.GroupNames() {
+		if len(difference([]string{name}, w.groups[other].Parents)) == 0 {
+			return fmt.Sprintf("group %q", other)
+		}
+	}
+	for _, other := range w.UserNames() {
+		if len(difference([]string{name}, w.users[other].Groups)) == 0 {
+			return fmt.Sprintf("user %q", other)
+		}
+	}
+	return ""
+}
+
+//RenameUser renames a user, see Tx.RenameUser
+func (w *Web) RenameUser(old string, new string) error {
+	return w.Update(func(tx *Tx) error {
+		return tx.RenameUser(old, new)
+	})
+}
+
+//RenameGroup renames a group and every reference to it at once, see Tx.RenameGroup
+func (w *Web) RenameGroup(old string, new string) error {
+	return w.Update(func(tx *Tx) error {
+		return tx.RenameGroup(old, new)
+	})
+}
+
+//RenameUser stages renaming the user old to new.
+//It fails with ErrMissingUser if old does not exist and ErrExists if new does.
+func (tx *Tx) RenameUser(old string, new string) error {
+	u := tx.GetUser(old)
+	if u == nil {
+		return errors.Wrapf(ErrMissingUser, "user %q", old)
+	}
+	if tx.GetUser(new) != nil {
+		return errors.Wrapf(ErrExists, "user %q", new)
+	}
+	tx.DelUser(u.Name)
+	u.Name = new
+	tx.AddUser(u)
+	return nil
+}
+
+//RenameGroup stages renaming the group old to new,
+//replacing it in the groups of every user and the parents of every group.
+//It fails with ErrMissingGroup if old does not exist and ErrExists if new does.
+func (tx *Tx) RenameGroup(old string, new string) error {
+	g := tx.GetGroup(old)
+	if g == nil {
+		return errors.Wrapf(ErrMissingGroup, "group %q", old)
+	}
+	if tx.GetGroup(new) != nil {
+		return errors.Wrapf(ErrExists, "group %q", new)
+	}
+	old = g.Name
+	tx.DelGroup(old)
+	g.Name = new
+	tx.AddGroup(g)
+	tx.replaceGroup(old, g.Name)
+	return nil
+}
+
+//replaceGroup stages replacing old with new in the groups of every user and the parents of every group.
+//old is removed instead if new is empty. Both must be normalized.
+func (tx *Tx) replaceGroup(old string, new string) {
+	replace := func(names []string) ([]string, bool) {
+		var replaced bool
+		out := make([]string, 0, len(names))
+		for _, name := range names {
+			if name != old {
+				out = append(out, name)
+				continue
+			}
+			replaced = true
+			if new != "" {
+				out = appendNames(out, []string{new})
+			}
+		}
+		return out, replaced
+	}
+
+	for _, name := range mergeNames(tx.web.GroupNames(), tx.groupNames()) {
+		if g := tx.GetGroup(name); g != nil {
+			var replaced bool
+			if g.Parents, replaced = replace(g.Parents); replaced {
+				tx.AddGroup(g)
+			}
+		}
+	}
+	for _, name := range mergeNames(tx.web.UserNames(), tx.userNames()) {
+		if u := tx.GetUser(name); u != nil {
+			var replaced bool
+			if u.Groups, replaced = replace(u.Groups); replaced {
+				tx.AddUser(u)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package perms
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWeb_RenameGroup(t *testing.T) {
+	web, store := storedTestWeb(t)
+	web.AddGroup(&Group{Name: "auditor", Parents: []string{"project_lead", "default"}})
+	web.AddUser(&User{Name: "bob", Groups: []string{"project_lead", "retired"}})
+	var events []Event
+	web.Subscribe(func(e Event) { events = append(events, e) })
+
+	if err := web.RenameGroup("project_lead", "analyst"); err != nil {
+		t.Fatalf("RenameGroup() = %v", err)
+	}
+	if g := web.GetGroup("auditor"); !reflect.DeepEqual(g.Parents, []string{"analyst", "default"}) {
+		t.Errorf("auditor parents = %v", g.Parents)
+	}
+	//references which were already missing are kept
+	if u := web.GetUser("bob"); !reflect.DeepEqual(u.Groups, []string{"analyst", "retired"}) {
+		t.Errorf("bob groups = %v", u.Groups)
+	}
+	if web.GetGroup("project_lead") != nil || !web.CheckUserHasPermission("ammar", MustParseNode("analytics.view")) {
+		t.Errorf("project_lead was not renamed")
+	}
+	if len(events) != 1 || events[0].Type != BatchApplied {
+		t.Errorf("events = %+v, want one BatchApplied", events)
+	}
+	restored := NewWeb()
+	restored.SetStore(store)
+	if !samePConf(restored, web) {
+		t.Errorf("store = %+v, want %+v", restored.MasterPConf(), web.MasterPConf())
+	}
+
+	if err := web.RenameGroup("nobody", "somebody"); errors.Cause(err) != ErrMissingGroup {
+		t.Errorf("RenameGroup(nobody) = %v, want ErrMissingGroup", err)
+	}
+	if err := web.RenameGroup("analyst", "manager"); errors.Cause(err) != ErrExists {
+		t.Errorf("RenameGroup(analyst, manager) = %v, want ErrExists", err)
+	}
+}
+
+func TestWeb_RenameUser(t *testing.T) {
+	web := testWeb()
+	web.SetNormalization(Normalization{FoldCase: true})
+	if err := web.RenameUser("Bob", "Robert"); err != nil {
+		t.Fatalf("RenameUser() = %v", err)
+	}
+	if web.GetUser("bob") != nil || !reflect.DeepEqual(web.GetUser("robert").Groups, []string{"project_lead"}) {
+		t.Errorf("bob was not renamed")
+	}
+	if err := web.RenameUser("bob", "carl"); errors.Cause(err) != ErrMissingUser {
+		t.Errorf("RenameUser(bob) = %v, want ErrMissingUser", err)
+	}
+	if err := web.RenameUser("robert", "AMMAR"); errors.Cause(err) != ErrExists {
+		t.Errorf("RenameUser(robert, AMMAR) = %v, want ErrExists", err)
+	}
+}
+
+func TestWeb_RenameUser_StoreFailure(t *testing.T) {
+	web, store := storedTestWeb(t)
+	web.store = userFailingStore{store}
+	if err := web.RenameUser("ammar", "carl"); errors.Cause(err) != errStore {
+		t.Fatalf("RenameUser() = %v, want %v", err, errStore)
+	}
+	if web.GetUser("ammar") == nil {
+		t.Errorf("a failed rename changed the web")
+	}
+	//the failure happened before ammar was deleted
+	if users, _ := store.UserNames(); !reflect.DeepEqual(users, []string{"ammar", "bob"}) {
+		t.Errorf("store users = %v, want [ammar bob]", users)
+	}
+}
+
+func TestWeb_SetDeletePolicy(t *testing.T) {
+	web := testWeb()
+	web.AddGroup(&Group{Name: "auditor", Parents: []string{"manager"}})
+
+	web.SetDeletePolicy(DeleteRefuse)
+	if err := web.DelGroup("manager"); errors.Cause(err) != ErrGroupInUse {
+		t.Errorf("DelGroup() = %v, want ErrGroupInUse", err)
+	}
+	if web.GetGroup("manager") == nil {
+		t.Errorf("DeleteRefuse deleted a group in use")
+	}
+	web.AddUser(&User{Name: "carl", Groups: []string{"auditor"}})
+	if err := web.DelGroup("project_lead"); errors.Cause(err) != ErrGroupInUse {
+		t.Errorf("DelGroup() = %v, want ErrGroupInUse", err)
+	}
+
+	web.SetDeletePolicy(DeleteCascade)
+	if err := web.DelGroup("manager"); err != nil {
+		t.Fatalf("DelGroup() = %v", err)
+	}
+	if web.GetGroup("manager") != nil || len(web.GetGroup("auditor").Parents) != 0 {
+		t.Errorf("DeleteCascade kept references to manager")
+	}
+	if u := web.GetUser("ammar"); !reflect.DeepEqual(u.Groups, []string{"project_lead"}) {
+		t.Errorf("ammar groups = %v", u.Groups)
+	}
+
+	web.SetDeletePolicy(DeleteKeep)
+	if err := web.DelGroup("auditor"); err != nil {
+		t.Fatalf("DelGroup() = %v", err)
+	}
+	if u := web.GetUser("carl"); !reflect.DeepEqual(u.Groups, []string{"auditor"}) {
+		t.Errorf("DeleteKeep changed carl's groups to %v", u.Groups)
+	}
+}
@@ -0,0 +1,268 @@
+package perms
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+//Clone returns a copy of w which can be changed without affecting w.
+//The registry, if any, is shared. The clone has no store, audit sink, history, feed or listeners.
+func (w *Web) Clone() *Web {
+	w.loadUsers()
+	clone := &Web{
+		groups:       make(map[string]*Group, len(w.groups)),
+		users:        make(map[string]*User, len(w.users)),
+		norm:         w.norm,
+		registry:     w.registry,
+		merge:        w.merge,
+		deletePolicy: w.deletePolicy,
+		groupSources: make(map[string]string, len(w.groupSources)),
+		userSources:  make(map[string]string, len(w.userSources)),
+		groupStates:  make(map[string]*AuditEntity, len(w.groupStates)),
+		userStates:   make(map[string]*AuditEntity, len(w.userStates)),
+	}
+	for name, source := range w.groupSources {
+		clone.groupSources[name] = source
+	}
+	for name, source := range w.userSources {
+		clone.userSources[name] = source
+	}
+	//states are never changed, only replaced
+	for name, state := range w.groupStates {
+		clone.groupStates[name] = state
+	}
+	for name, state := range w.userStates {
+		clone.userStates[name] = state
+	}
+	for name, g := range w.groups {
+		clone.groups[name] = copyGroup(g)
+	}
+	for name, u := range w.users {
+		clone.users[name] = copyUser(u)
+	}
+	return clone
+}
+
+//EditOp is the kind of change an Edit makes
+type EditOp string
+
+//edit operations
+const (
+	//EditAddNode adds Node to Group, or to User if Group is empty
+	EditAddNode EditOp = "add-node"
+	//EditRemoveNode removes Node from Group, or from User if Group is empty
+	EditRemoveNode EditOp = "remove-node"
+	//EditJoinGroup adds User to Group
+	EditJoinGroup EditOp = "join-group"
+	//EditLeaveGroup removes User from Group
+	EditLeaveGroup EditOp = "leave-group"
+	//EditMoveUser removes User from From and adds it to Group
+	EditMoveUser EditOp = "move-user"
+	//EditDelGroup deletes Group
+	EditDelGroup EditOp = "del-group"
+	//EditDelUser deletes User
+	EditDelUser EditOp = "del-user"
+)
+
+//Edit is a proposed change to a Web
+type Edit struct {
+	Op    EditOp `json:"op"`
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+	//From is the group EditMoveUser moves User out of
+	From string `json:"from,omitempty"`
+	//Node is parsed under the normalization policy of the web
+	Node string `json:"node,omitempty"`
+}
+
+//String returns a human readable description of e
+func (e Edit) String() string {
+	target := fmt.Sprintf("group %v", e.Group)
+	if e.Group == "" {
+		target = fmt.Sprintf("user %v", e.User)
+	}
+	switch e.Op {
+	case EditAddNode:
+		return fmt.Sprintf("add %v to %v", e.Node, target)
+	case EditRemoveNode:
+		return fmt.Sprintf("remove %v from %v", e.Node, target)
+	case EditJoinGroup:
+		return fmt.Sprintf("add user %v to group %v", e.User, e.Group)
+	case EditLeaveGroup:
+		return fmt.Sprintf("remove user %v from group %v", e.User, e.Group)
+	case EditMoveUser:
+		return fmt.Sprintf("move user %v from group %v to group %v", e.User, e.From, e.Group)
+	case EditDelGroup:
+		return fmt.Sprintf("delete group %v", e.Group)
+	case EditDelUser:
+		return fmt.Sprintf("delete user %v", e.User)
+	}
+	return fmt.Sprintf("unknown edit %q", e.Op)
+}
+
+//apply makes the change described by e to w
+func (w *Web) apply(e Edit) error {
+	user, group := w.norm.Normalize(e.User), w.norm.Normalize(e.Group)
+
+	getUser := func() (*User, error) {
+		if u := w.users[user]; u != nil {
+			return u, nil
+		}
+		return nil, errors.Errorf("user %q does not exist", e.User)
+	}
+	getGroup := func() (*Group, error) {
+		if g := w.groups[group]; g != nil {
+			return g, nil
+		}
+		return nil, errors.Errorf("group %q does not exist", e.Group)
+	}
+	//nodes returns the nodes the edit targets
+	nodes := func() (*Nodes, error) {
+		if e.Group == "" {
+			u, err := getUser()
+			if err != nil {
+				return nil, err
+			}
+			return &u.Nodes, nil
+		}
+		g, err := getGroup()
+		if err != nil {
+			return nil, err
+		}
+		return &g.Nodes, nil
+	}
+
+	switch e.Op {
+	case EditAddNode, EditRemoveNode:
+		node, err := w.norm.ParseNode(e.Node)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse node %q", e.Node)
+		}
+		ns, err := nodes()
+		if err != nil {
+			return err
+		}
+		if e.Op == EditAddNode {
+			*ns = append(*ns, node)
+			return nil
+		}
+		str := node.String()
+		for i, n := range *ns {
+			if n.String() == str {
+				*ns = append((*ns)[:i], (*ns)[i+1:]...)
+				return nil
+			}
+		}
+		return errors.Errorf("%v does not exist", str)
+	case EditJoinGroup, EditMoveUser:
+		u, err := getUser()
+		if err != nil {
+			return err
+		}
+		if _, err := getGroup(); err != nil {
+			return err
+		}
+		if e.Op == EditMoveUser {
+			if err := leave(u, w.norm.Normalize(e.From)); err != nil {
+				return err
+			}
+		}
+		for _, g := range u.Groups {
+			if g == group {
+				return nil
+			}
+		}
+		u.Groups = append(u.Groups, group)
+	case EditLeaveGroup:
+		u, err := getUser()
+		if err != nil {
+			return err
+		}
+		return leave(u, group)
+	case EditDelGroup:
+		if _, err := getGroup(); err != nil {
+			return err
+		}
+		return w.DelGroup(group)
+	case EditDelUser:
+		if _, err := getUser(); err != nil {
+			return err
+		}
+		return w.DelUser(user)
+	default:
+		return errors.Errorf("unknown edit %q", e.Op)
+	}
+	return nil
+}
+
+//leave removes u from group
+func leave(u *User, group string) error {
+	for i, g := range u.Groups {
+		if g == group {
+			u.Groups = append(u.Groups[:i], u.Groups[i+1:]...)
+			return nil
+		}
+	}
+	return errors.Errorf("user %q is not in group %q", u.Name, group)
+}
+
+//Sandbox answers checks against a Web as if proposed edits were made to it.
+//The original Web is never changed.
+type Sandbox struct {
+	base  *Web
+	web   *Web
+	edits []Edit
+}
+
+//NewSandbox returns a sandbox of w without any edits.
+//Changes made to w afterwards are not seen by the sandbox.
+func NewSandbox(w *Web) *Sandbox {
+	return &Sandbox{base: w.Clone(), web: w.Clone()}
+}
+
+//Apply makes edits in order.
+//If any of them fails none are made and the error describes the one which failed.
+func (s *Sandbox) Apply(edits ...Edit) error {
+	web := s.web.Clone()
+	for i, e := range edits {
+		if err := web.apply(e); err != nil {
+			return errors.Wrapf(err, "edit %v: %v", i, e)
+		}
+	}
+	s.web = web
+	s.edits = append(s.edits, edits...)
+	return nil
+}
+
+//Edits returns the edits made so far
+func (s *Sandbox) Edits() []Edit {
+	return append([]Edit{}, s.edits...)
+}
+
+//Reset discards every edit
+func (s *Sandbox) Reset() {
+	s.web = s.base.Clone()
+	s.edits = nil
+}
+
+//Web returns the hypothetical web.
+//Changing it directly affects the sandbox but not the original web.
+func (s *Sandbox) Web() *Web {
+	return s.web
+}
+
+//CheckUserHasPermission checks if a user would have a permission
+func (s *Sandbox) CheckUserHasPermission(name string, check Node) bool {
+	return s.web.CheckUserHasPermission(name, check)
+}
+
+//Explain describes how a check would be decided
+func (s *Sandbox) Explain(name string, check Node) Explanation {
+	return s.web.Explain(name, check)
+}
+
+//Impact compares the original web with the hypothetical one like Diff
+func (s *Sandbox) Impact(probes Nodes) WebDiff {
+	return Diff(s.base, s.web, probes)
+}
@@ -0,0 +1,98 @@
+package perms
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWeb_Clone(t *testing.T) {
+	web := testWeb()
+	clone := web.Clone()
+	clone.GetGroup("manager").Nodes[0] = MustParseNode("-projects.*")
+	clone.GetUser("bob").Groups = append(clone.GetUser("bob").Groups, "manager")
+	clone.DelUser("ammar")
+
+	if !reflect.DeepEqual(web.MasterPConf(), testWeb().MasterPConf()) {
+		t.Errorf("changing a clone changed the original")
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	web := testWeb()
+	box := NewSandbox(web)
+
+	err := box.Apply(
+		Edit{Op: EditAddNode, Group: "project_lead", Node: "projects.*.view"},
+		Edit{Op: EditMoveUser, User: "ammar", From: "manager", Group: "project_lead"},
+		Edit{Op: EditRemoveNode, User: "ammar", Node: "projects.secret.build"},
+		Edit{Op: EditDelGroup, Group: "manager"},
+	)
+	if err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+
+	tests := []struct {
+		user  string
+		check string
+		had   bool
+		has   bool
+	}{
+		{"bob", "projects.webserver.view", false, true},
+		{"ammar", "projects.webserver.build", true, false},
+		{"ammar", "projects.secret.view", false, true},
+		{"ammar", "projects.secret.build", true, false},
+	}
+	for _, tt := range tests {
+		check := MustParseNode(tt.check)
+		if had := web.CheckUserHasPermission(tt.user, check); had != tt.had {
+			t.Errorf("original %v %v = %v, want %v", tt.user, tt.check, had, tt.had)
+		}
+		if has := box.CheckUserHasPermission(tt.user, check); has != tt.has {
+			t.Errorf("sandbox %v %v = %v, want %v", tt.user, tt.check, has, tt.has)
+		}
+	}
+	if web.GetGroup("manager") == nil {
+		t.Errorf("Apply() deleted a group of the original")
+	}
+
+	impact := box.Impact(MustParseNodes(strings.NewReader("projects.secret.build")))
+	want := []Impact{{User: "ammar", Lost: []string{"projects.secret.build"}}}
+	if !reflect.DeepEqual(impact.Impact, want) {
+		t.Errorf("Impact() = %+v, want %+v", impact.Impact, want)
+	}
+
+	//a failing edit undoes the whole batch
+	err = box.Apply(
+		Edit{Op: EditDelUser, User: "bob"},
+		Edit{Op: EditJoinGroup, User: "carl", Group: "project_lead"},
+	)
+	if err == nil {
+		t.Fatalf("Apply() with a missing user succeeded")
+	}
+	if box.Web().GetUser("bob") == nil || len(box.Edits()) != 4 {
+		t.Errorf("failed Apply() was partially made")
+	}
+
+	box.Reset()
+	if !box.CheckUserHasPermission("ammar", MustParseNode("projects.secret.build")) || len(box.Edits()) != 0 {
+		t.Errorf("Reset() kept edits")
+	}
+}
+
+func TestEdit_String(t *testing.T) {
+	tests := []struct {
+		edit Edit
+		want string
+	}{
+		{Edit{Op: EditAddNode, Group: "manager", Node: "projects.*"}, "add projects.* to group manager"},
+		{Edit{Op: EditRemoveNode, User: "bob", Node: "projects.*"}, "remove projects.* from user bob"},
+		{Edit{Op: EditMoveUser, User: "bob", From: "a", Group: "b"}, "move user bob from group a to group b"},
+		{Edit{Op: "rename"}, `unknown edit "rename"`},
+	}
+	for _, tt := range tests {
+		if got := tt.edit.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package perms
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/stratexio/perms/whitespace"
+)
+
+//SchemaError describes where a PConf does not match the schema
+type SchemaError struct {
+	//Path is the JSON path of the problem, such as $.groups.manager.parent
+	Path    string
+	Message string
+}
+
+//Error returns the path followed by the message
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Path, e.Message)
+}
+
+//schema is the subset of JSON Schema needed to describe a PConf
+type schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 interface{}        `json:"type"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+var (
+	pconfSchemaOnce sync.Once
+	pconfSchema     *schema
+	//nodePattern is the pattern of nodes in the schema, which is written for JavaScript
+	nodePattern string
+	//nodeRegexp is nodePattern for Go
+	nodeRegexp *regexp.Regexp
+)
+
+//nodePatterns returns a pattern matching anything ParseNode accepts:
+//no whitespace and not starting with a separator.
+//escape writes a rune the way the regular expression dialect requires.
+func nodePatterns(escape func(r rune) string) string {
+	var space string
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+		if whitespace.Is(r) {
+			space += escape(r)
+		}
+	}
+	return `^[^\` + PartSeperator + space + `][^` + space + `]*$`
+}
+
+//loadSchema generates the schema of PConf from its fields
+func loadSchema() *schema {
+	pconfSchemaOnce.Do(func() {
+		nodePattern = nodePatterns(func(r rune) string { return fmt.Sprintf(`\u%04x`, r) })
+		nodeRegexp = regexp.MustCompile(nodePatterns(func(r rune) string { return fmt.Sprintf(`\x{%04x}`, r) }))
+
+		pconfSchema = schemaOf(reflect.TypeOf(PConf{}), "")
+		pconfSchema.Schema = "http://json-schema.org/draft-07/schema#"
+		pconfSchema.Title = "PConf"
+	})
+	return pconfSchema
+}
+
+//schemaOf returns the schema of values of t.
+//kind is the schema tag of the field holding them.
+func schemaOf(t reflect.Type, kind string) *schema {
+	switch t.Kind() {
+	case reflect.String:
+		s := &schema{Type: "string"}
+		if kind == "node" {
+			s.Pattern = nodePattern
+		}
+		return s
+	case reflect.Slice:
+		return &schema{Type: []string{"array", "null"}, Items: schemaOf(t.Elem(), kind)}
+	case reflect.Map:
+		return &schema{Type: []string{"object", "null"}, AdditionalProperties: schemaOf(t.Elem(), kind)}
+	case reflect.Struct:
+		s := &schema{Type: "object", Properties: make(map[string]*schema), AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			s.Properties[name] = schemaOf(field.Type, field.Tag.Get("schema"))
+		}
+		return s
+	}
+	panic(fmt.Sprintf("no schema for %v", t))
+}
+
+//PConfSchema returns the JSON Schema of PConfs
+func PConfSchema() ([]byte, error) {
+	return json.MarshalIndent(loadSchema(), "", "    ")
+}
+
+//JSONPath appends a key to a JSON path such as $.users, quoting it unless it is a plain identifier
+func JSONPath(path string, key string) string {
+	if plainKey.MatchString(key) {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%v[%q]", path, key)
+}
+
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+//validate checks a decoded document against s
+func (s *schema) validate(path string, v interface{}) error {
+	types := []string{}
+	switch t := s.Type.(type) {
+	case string:
+		types = append(types, t)
+	case []string:
+		types = t
+	}
+	fail := func(format string, args ...interface{}) error {
+		return &SchemaError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		if !contains(types, "null") {
+			return fail("expected %v, got null", types[0])
+		}
+	case string:
+		if !contains(types, "string") {
+			return fail("expected %v, got string %q", types[0], v)
+		}
+		//nodes have the only pattern
+		if s.Pattern != "" && !nodeRegexp.MatchString(v) {
+			return fail("%q is not a valid node", v)
+		}
+	case []interface{}:
+		if !contains(types, "array") {
+			return fail("expected %v, got array", types[0])
+		}
+		for i, item := range v {
+			if err := s.Items.validate(fmt.Sprintf("%v[%v]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if !contains(types, "object") {
+			return fail("expected %v, got object", types[0])
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			property := s.Properties[key]
+			if property == nil {
+				additional, ok := s.AdditionalProperties.(*schema)
+				if !ok {
+					return &SchemaError{Path: JSONPath(path, key), Message: "unknown key"}
+				}
+				property = additional
+			}
+			if err := property.validate(JSONPath(path, key), v[key]); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		//YAML decodes mappings with keys which are not strings, such as numeric user ids, this way
+		converted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			converted[fmt.Sprint(key)] = value
+		}
+		return s.validate(path, converted)
+	default:
+		return fail("expected %v, got %T", types[0], v)
+	}
+	return nil
+}
+
+//validatePConf checks a decoded PConf document against the schema.
+//An empty document is valid.
+func validatePConf(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	return loadSchema().validate("$", v)
+}
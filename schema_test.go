@@ -0,0 +1,86 @@
+package perms
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestPConfSchema_File(t *testing.T) {
+	schema, err := PConfSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, err := ioutil.ReadFile("pconf.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(schema, '\n'), published) {
+		t.Errorf("pconf.schema.json is out of date, replace it with PConfSchema():\n%s", schema)
+	}
+}
+
+func TestParsePConf_Schema(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+		path   string
+	}{
+		{FormatJSON, `{"groups": {"manager": {"parent": ["project_lead"]}}}`, "$.groups.manager.parent"},
+		{FormatJSON, `{"group": {}}`, "$.group"},
+		{FormatJSON, `{"users": {"ammar": {"nodes": ["projects.*", "bad node"]}}}`, "$.users.ammar.nodes[1]"},
+		{FormatJSON, `{"users": {"ammar": {"nodes": [".projects"]}}}`, "$.users.ammar.nodes[0]"},
+		{FormatJSON, `{"users": {"ammar": {"groups": "manager"}}}`, "$.users.ammar.groups"},
+		{FormatJSON, `{"users": {"ammar.b": {"groups": [1]}}}`, `$.users["ammar.b"].groups[0]`},
+		{FormatJSON, `[]`, "$"},
+		{FormatYAML, "groups:\n    manager:\n        parent: [project_lead]\n", "$.groups.manager.parent"},
+		{FormatYAML, "users:\n    123:\n        group: [manager]\n", `$.users["123"].group`},
+		{FormatTOML, "[users.ammar]\nnode = [\"projects.*\"]\n", "$.users.ammar.node"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePConfFormat([]byte(tt.input), tt.format)
+		schemaErr, ok := errors.Cause(err).(*SchemaError)
+		if !ok || schemaErr.Path != tt.path {
+			t.Errorf("ParsePConfFormat(%q, %v) = %v, want an error at %v", tt.input, tt.format, err, tt.path)
+		}
+	}
+
+	_, err := ParsePConf([]byte(`{"groups": {"manager": {"parent": ["project_lead"]}}}`))
+	if want := `failed to decode: $.groups.manager.parent: unknown key`; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+
+	valid := []string{
+		`{}`,
+		`null`,
+		`{"groups": null, "users": {"ammar": {"groups": null, "nodes": ["-projects.*", "-"]}}}`,
+		`{"include": ["base.json"], "groups": {"manager": {"parents": [], "nodes": ["projects.*"]}}}`,
+	}
+	for _, input := range valid {
+		if _, err := ParsePConf([]byte(input)); err != nil {
+			t.Errorf("ParsePConf(%q) = %v", input, err)
+		}
+	}
+}
+
+func TestParsePConf_SchemaNumericKeys(t *testing.T) {
+	pconf, err := ParsePConfFormat([]byte("users:\n    123:\n        groups: [manager]\n    ammar: {}\n"), FormatYAML)
+	if err != nil {
+		t.Fatalf("ParsePConfFormat() = %v", err)
+	}
+	if u, ok := pconf.Users["123"]; !ok || len(u.Groups) != 1 || u.Groups[0] != "manager" {
+		t.Errorf("users = %+v", pconf.Users)
+	}
+}
+
+func TestParsePConf_SchemaAgreesWithParseNode(t *testing.T) {
+	loadSchema()
+	for _, raw := range []string{"a", "-a", "a.b.*", "-", "a..b", "", ".a", "a b", "a　b", "-.a", "a.", " a"} {
+		_, err := ParseNode(raw)
+		if valid := nodeRegexp.MatchString(raw); valid != (err == nil) {
+			t.Errorf("%q: schema says valid = %v, ParseNode() = %v", raw, valid, err)
+		}
+	}
+}
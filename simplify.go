@@ -0,0 +1,159 @@
+package perms
+
+import (
+	"bytes"
+	"fmt"
+)
+
+//RemovalReason explains why Simplify removed a node
+type RemovalReason string
+
+//reasons a node may be removed
+const (
+	//ReasonDuplicate means the exact same node appears earlier in the list
+	ReasonDuplicate RemovalReason = "duplicate"
+	//ReasonCovered means other nodes of the same kind already match everything it matches
+	ReasonCovered RemovalReason = "covered"
+	//ReasonNegated means everything the node grants is negated
+	ReasonNegated RemovalReason = "negated"
+	//ReasonNegatesNothing means the negation does not match anything granted by the list.
+	//When the list belongs to a user or group in a Web, the negation may still
+	//override nodes granted elsewhere.
+	ReasonNegatesNothing RemovalReason = "negates nothing"
+)
+
+//Removal describes a node removed by Simplify
+type Removal struct {
+	Node Node
+	//Index is the position of Node in the list passed to Simplify
+	Index  int
+	Reason RemovalReason
+	//By lists the nodes responsible for the removal, if any single ones are
+	By Nodes
+}
+
+//String returns a human readable description of r
+func (r Removal) String() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%v: %v", r.Node, r.Reason)
+	if len(r.By) > 0 {
+		buf.WriteString(" by ")
+		for i, n := range r.By {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(n.String())
+		}
+	}
+	return buf.String()
+}
+
+//Simplify returns a minimal list equivalent to ns along with every node it removed.
+//No node can be removed from the returned list without changing what it grants.
+//The order of the remaining nodes is preserved.
+func (ns Nodes) Simplify() (Nodes, []Removal) {
+	var removals []Removal
+
+	kept := make(Nodes, 0, len(ns))
+	//indexes holds the position in ns of each kept node
+	indexes := make([]int, 0, len(ns))
+	for i, n := range ns {
+		str := n.String()
+		var dup bool
+		for _, k := range kept {
+			if k.String() == str {
+				removals = append(removals, Removal{Node: n, Index: i, Reason: ReasonDuplicate, By: Nodes{k}})
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			kept = append(kept, n)
+			indexes = append(indexes, i)
+		}
+	}
+
+	//without is kept with the node at i removed
+	without := func(i int) Nodes {
+		rest := make(Nodes, 0, len(kept)-1)
+		rest = append(rest, kept[:i]...)
+		return append(rest, kept[i+1:]...)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(kept); i++ {
+			n := kept[i]
+			rest := without(i)
+			grants, negations := rest.split()
+
+			var removal *Removal
+			if n.Negate {
+				removal = simplifyNegation(n, grants, negations)
+			} else {
+				removal = simplifyGrant(n, rest, grants, negations)
+			}
+			if removal == nil {
+				continue
+			}
+
+			removal.Index = indexes[i]
+			removals = append(removals, *removal)
+			kept = rest
+			indexes = append(indexes[:i], indexes[i+1:]...)
+			changed = true
+			i--
+		}
+	}
+
+	return kept, removals
+}
+
+//simplifyGrant returns a removal if the grant n adds nothing to rest
+func simplifyGrant(n Node, rest Nodes, grants []Node, negations []Node) *Removal {
+	if coveredBy(n, negations) {
+		var by Nodes
+		for _, neg := range negations {
+			if _, ok := intersect(n, neg); ok {
+				by = append(by, neg)
+			}
+		}
+		return &Removal{Node: n, Reason: ReasonNegated, By: by}
+	}
+
+	if !rest.within(n, negations) {
+		return nil
+	}
+	for _, g := range grants {
+		if Covers(g, n) {
+			return &Removal{Node: n, Reason: ReasonCovered, By: Nodes{g}}
+		}
+	}
+	return &Removal{Node: n, Reason: ReasonCovered}
+}
+
+//simplifyNegation returns a removal if the negation n takes away nothing
+//that the other negations don't already
+func simplifyNegation(n Node, grants []Node, negations []Node) *Removal {
+	var overlaps bool
+	for _, g := range grants {
+		c, ok := intersect(n, g)
+		if !ok {
+			continue
+		}
+		overlaps = true
+		if !coveredBy(c, negations) {
+			return nil
+		}
+	}
+
+	if !overlaps {
+		return &Removal{Node: n, Reason: ReasonNegatesNothing}
+	}
+	for _, neg := range negations {
+		if Covers(neg, n) {
+			return &Removal{Node: n, Reason: ReasonCovered, By: Nodes{neg}}
+		}
+	}
+	return &Removal{Node: n, Reason: ReasonCovered}
+}
@@ -0,0 +1,99 @@
+package perms
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestNodes_Simplify(t *testing.T) {
+	tests := []struct {
+		name     string
+		ns       string
+		want     string
+		removals []string
+	}{
+		{
+			"covered",
+			"projects.* projects.webserver.build",
+			"projects.*",
+			[]string{"projects.webserver.build: covered by projects.*"},
+		},
+		{
+			"duplicate",
+			"projects.build analytics.* projects.build",
+			"projects.build\nanalytics.*",
+			[]string{"projects.build: duplicate by projects.build"},
+		},
+		{
+			"negates_nothing",
+			"projects.* -billing.*",
+			"projects.*",
+			[]string{"-billing.*: negates nothing"},
+		},
+		{
+			"negated",
+			"projects.webserver.build -projects.* analytics.*",
+			"analytics.*",
+			[]string{
+				"projects.webserver.build: negated by -projects.*",
+				"-projects.*: negates nothing",
+			},
+		},
+		{
+			"covered_negation",
+			"projects.* -projects.*.chat.moderate -projects.webserver.chat.moderate",
+			"projects.*\n-projects.*.chat.moderate",
+			[]string{"-projects.webserver.chat.moderate: covered by -projects.*.chat.moderate"},
+		},
+		{
+			"minimal",
+			"projects.* -projects.secret",
+			"projects.*\n-projects.secret",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removals := MustParseNodes(strings.NewReader(tt.ns)).Simplify()
+			if got.String() != tt.want {
+				t.Errorf("Simplify() = %q, want %q", got, tt.want)
+			}
+			if len(removals) != len(tt.removals) {
+				t.Fatalf("Simplify() removals = %v, want %v", removals, tt.removals)
+			}
+			for i, r := range removals {
+				if r.String() != tt.removals[i] {
+					t.Errorf("removal %v = %q, want %q", i, r, tt.removals[i])
+				}
+			}
+		})
+	}
+
+	property := func(qns quickNodes) bool {
+		ns := Nodes(qns)
+		got, removals := ns.Simplify()
+		if len(got)+len(removals) != len(ns) {
+			return false
+		}
+		for _, r := range removals {
+			if ns[r.Index].String() != r.Node.String() {
+				return false
+			}
+		}
+		if !agrees(got, func(u Node) bool { return granted(ns, u) }) {
+			return false
+		}
+		//removing any remaining node must change what is granted
+		for i := range got {
+			rest := append(append(Nodes{}, got[:i]...), got[i+1:]...)
+			if rest.Equivalent(got) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
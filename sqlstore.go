@@ -0,0 +1,294 @@
+package perms
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Placeholder is the style of query parameters a database driver expects
+type Placeholder int
+
+//placeholder styles
+const (
+	//PlaceholderQuestion writes parameters as ?, as SQLite and MySQL expect
+	PlaceholderQuestion Placeholder = iota
+	//PlaceholderDollar writes parameters as $1, $2 and so on, as PostgreSQL expects
+	PlaceholderDollar
+)
+
+//SQLStore is a Store in a database/sql database.
+//Groups and users are rows of the perms_groups and perms_users tables,
+//with their nodes in the newline delimited text form of Nodes.Value.
+//Group parents are rows of perms_group_parents and user memberships are rows of perms_user_groups.
+//Saving a user or group only touches its own rows.
+//
+//SQLStore is a LazyStore, so a Web with one loads users the first time they are needed.
+type SQLStore struct {
+	db          *sql.DB
+	placeholder Placeholder
+}
+
+//sqlSchema creates the tables of a SQLStore if they do not exist.
+//References are not foreign keys because users and groups may reference groups which do not exist.
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS perms_groups (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	nodes TEXT NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS perms_users (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	nodes TEXT NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS perms_group_parents (
+	group_name VARCHAR(255) NOT NULL,
+	seq INTEGER NOT NULL,
+	parent VARCHAR(255) NOT NULL,
+	PRIMARY KEY (group_name, seq)
+)`,
+	`CREATE TABLE IF NOT EXISTS perms_user_groups (
+	user_name VARCHAR(255) NOT NULL,
+	seq INTEGER NOT NULL,
+	group_name VARCHAR(255) NOT NULL,
+	PRIMARY KEY (user_name, seq)
+)`,
+}
+
+//NewSQLStore returns a store in db, creating its tables if they do not exist
+func NewSQLStore(db *sql.DB, placeholder Placeholder) (*SQLStore, error) {
+	s := &SQLStore{db: db, placeholder: placeholder}
+	for _, stmt := range sqlSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, errors.Wrap(err, "failed to create schema")
+		}
+	}
+	return s, nil
+}
+
+//query rewrites the ? parameters of q in the placeholder style of s
+func (s *SQLStore) query(q string) string {
+	if s.placeholder != PlaceholderDollar {
+		return q
+	}
+	parts := strings.Split(q, "?")
+	buf := new(strings.Builder)
+	for i, part := range parts {
+		buf.WriteString(part)
+		if i < len(parts)-1 {
+			fmt.Fprintf(buf, "$%d", i+1)
+		}
+	}
+	return buf.String()
+}
+
+//Load returns every group and user in s in order
+func (s *SQLStore) Load() ([]*Group, []*User, error) {
+	groups, err := s.LoadGroups()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users := make([]*User, 0, 20)
+	byName := make(map[string]*User, 20)
+	err = s.each("SELECT name, nodes FROM perms_users ORDER BY name", func(rows *sql.Rows) error {
+		u := NewUser("")
+		if err := rows.Scan(&u.Name, &u.Nodes); err != nil {
+			return err
+		}
+		users = append(users, u)
+		byName[u.Name] = u
+		return nil
+	})
+	if err == nil {
+		err = s.each("SELECT user_name, group_name FROM perms_user_groups ORDER BY user_name, seq", func(rows *sql.Rows) error {
+			var user, group string
+			if err := rows.Scan(&user, &group); err != nil {
+				return err
+			}
+			if u := byName[user]; u != nil {
+				u.Groups = append(u.Groups, group)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to load users")
+	}
+	return groups, users, nil
+}
+
+//LoadGroups returns every group in s in order
+func (s *SQLStore) LoadGroups() ([]*Group, error) {
+	groups := make([]*Group, 0, 20)
+	byName := make(map[string]*Group, 20)
+	err := s.each("SELECT name, nodes FROM perms_groups ORDER BY name", func(rows *sql.Rows) error {
+		g := NewGroup("")
+		if err := rows.Scan(&g.Name, &g.Nodes); err != nil {
+			return err
+		}
+		groups = append(groups, g)
+		byName[g.Name] = g
+		return nil
+	})
+	if err == nil {
+		err = s.each("SELECT group_name, parent FROM perms_group_parents ORDER BY group_name, seq", func(rows *sql.Rows) error {
+			var group, parent string
+			if err := rows.Scan(&group, &parent); err != nil {
+				return err
+			}
+			if g := byName[group]; g != nil {
+				g.Parents = append(g.Parents, parent)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load groups")
+	}
+	return groups, nil
+}
+
+//LoadUser returns a user, or nil if it is not in s
+func (s *SQLStore) LoadUser(name string) (*User, error) {
+	u := NewUser(name)
+	err := s.db.QueryRow(s.query("SELECT nodes FROM perms_users WHERE name = ?"), name).Scan(&u.Nodes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err == nil {
+		err = s.each("SELECT group_name FROM perms_user_groups WHERE user_name = ? ORDER BY seq", func(rows *sql.Rows) error {
+			var group string
+			if err := rows.Scan(&group); err != nil {
+				return err
+			}
+			u.Groups = append(u.Groups, group)
+			return nil
+		}, name)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load user %q", name)
+	}
+	return u, nil
+}
+
+//each runs q and calls scan for every row
+func (s *SQLStore) each(q string, scan func(rows *sql.Rows) error, args ...interface{}) error {
+	rows, err := s.db.Query(s.query(q), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+//save updates or inserts the row of name in table and replaces its references in refTable in one transaction.
+//refTable is keyed by owner and holds the references in ref.
+func (s *SQLStore) save(table string, name string, nodes Nodes, refTable string, owner string, ref string, refs []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		//RowsAffected of an UPDATE can not tell a missing row from an unchanged one on every database
+		var rows int
+		if err := tx.QueryRow(s.query("SELECT COUNT(*) FROM "+table+" WHERE name = ?"), name).Scan(&rows); err != nil {
+			return err
+		}
+		update := "INSERT INTO " + table + " (nodes, name) VALUES (?, ?)"
+		if rows > 0 {
+			update = "UPDATE " + table + " SET nodes = ? WHERE name = ?"
+		}
+		if _, err := tx.Exec(s.query(update), nodes, name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(s.query("DELETE FROM "+refTable+" WHERE "+owner+" = ?"), name); err != nil {
+			return err
+		}
+		for i, r := range refs {
+			if _, err := tx.Exec(s.query("INSERT INTO "+refTable+" ("+owner+", seq, "+ref+") VALUES (?, ?, ?)"), name, i, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+//del deletes the row of name from table and its references from refTable in one transaction
+func (s *SQLStore) del(table string, name string, refTable string, owner string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.query("DELETE FROM "+refTable+" WHERE "+owner+" = ?"), name); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(s.query("DELETE FROM "+table+" WHERE name = ?"), name); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+//SaveGroup creates or replaces a group
+func (s *SQLStore) SaveGroup(g *Group) error {
+	err := s.save("perms_groups", g.Name, g.Nodes, "perms_group_parents", "group_name", "parent", g.Parents)
+	return errors.Wrapf(err, "failed to save group %q", g.Name)
+}
+
+//SaveUser creates or replaces a user
+func (s *SQLStore) SaveUser(u *User) error {
+	err := s.save("perms_users", u.Name, u.Nodes, "perms_user_groups", "user_name", "group_name", u.Groups)
+	return errors.Wrapf(err, "failed to save user %q", u.Name)
+}
+
+//DelGroup deletes a group. Memberships of the group are kept, as they are in a Web.
+func (s *SQLStore) DelGroup(name string) error {
+	return errors.Wrapf(s.del("perms_groups", name, "perms_group_parents", "group_name"), "failed to delete group %q", name)
+}
+
+//DelUser deletes a user
+func (s *SQLStore) DelUser(name string) error {
+	return errors.Wrapf(s.del("perms_users", name, "perms_user_groups", "user_name"), "failed to delete user %q", name)
+}
+
+//GroupNames returns the names of every group in s in order
+func (s *SQLStore) GroupNames() ([]string, error) {
+	names, err := s.names("SELECT name FROM perms_groups ORDER BY name")
+	return names, errors.Wrap(err, "failed to list groups")
+}
+
+//UserNames returns the names of every user in s in order
+func (s *SQLStore) UserNames() ([]string, error) {
+	names, err := s.names("SELECT name FROM perms_users ORDER BY name")
+	return names, errors.Wrap(err, "failed to list users")
+}
+
+//names returns the names q selects
+func (s *SQLStore) names(q string) ([]string, error) {
+	names := make([]string, 0, 20)
+	err := s.each(q, func(rows *sql.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
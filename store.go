@@ -0,0 +1,215 @@
+package perms
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//Store persists the users and groups of a Web.
+//A Web with a store saves every user and group it adds and deletes the ones it deletes,
+//see Web.SetStore. Names given to a store are already normalized.
+type Store interface {
+	//Load returns every group and user in the store
+	Load() ([]*Group, []*User, error)
+	//SaveGroup creates or replaces a group
+	SaveGroup(g *Group) error
+	//SaveUser creates or replaces a user
+	SaveUser(u *User) error
+	//DelGroup deletes a group. Deleting a group which does not exist is not an error.
+	DelGroup(name string) error
+	//DelUser deletes a user. Deleting a user which does not exist is not an error.
+	DelUser(name string) error
+	//GroupNames returns the names of every group in order
+	GroupNames() ([]string, error)
+	//UserNames returns the names of every user in order
+	UserNames() ([]string, error)
+}
+
+//LazyStore is a Store which can load groups and users separately.
+//A Web with a LazyStore loads every group when the store is attached,
+//but each user only the first time it is checked, so large stores attach quickly.
+type LazyStore interface {
+	Store
+	//LoadGroups returns every group in the store
+	LoadGroups() ([]*Group, error)
+	//LoadUser returns a user, or nil if it is not in the store
+	LoadUser(name string) (*User, error)
+}
+
+//lazyUsers tracks the users a Web has not loaded from its LazyStore yet.
+//Checks load users, so the users of a lazy web are only read and written with mu held.
+type lazyUsers struct {
+	mu    sync.Mutex
+	store LazyStore
+	//all is set once every user has been loaded
+	all bool
+	//absent holds names which are not in the store
+	absent map[string]bool
+}
+
+//user returns the user of a normalized name, loading it from the lazy store of w if needed.
+//A user which fails to load is treated as missing and tried again next time.
+func (w *Web) user(name string) *User {
+	if w.lazy == nil {
+		return w.users[name]
+	}
+	w.lazy.mu.Lock()
+	defer w.lazy.mu.Unlock()
+	if u := w.users[name]; u != nil || w.lazy.all || w.lazy.absent[name] {
+		return u
+	}
+	u, err := w.lazy.store.LoadUser(name)
+	if err != nil {
+		return nil
+	}
+	if u == nil {
+		w.lazy.absent[name] = true
+		return nil
+	}
+	w.normalizeUser(u)
+	w.users[u.Name] = u
+	w.userStates[u.Name] = auditUser(u)
+	return u
+}
+
+//loadUsers loads every user w has not loaded from its lazy store yet
+func (w *Web) loadUsers() error {
+	if w.lazy == nil {
+		return nil
+	}
+	w.lazy.mu.Lock()
+	defer w.lazy.mu.Unlock()
+	if w.lazy.all {
+		return nil
+	}
+	_, users, err := w.lazy.store.Load()
+	if err != nil {
+		return errors.Wrap(err, "failed to load users")
+	}
+	for _, u := range users {
+		w.normalizeUser(u)
+		if w.users[u.Name] == nil {
+			w.users[u.Name] = u
+			w.userStates[u.Name] = auditUser(u)
+		}
+	}
+	w.lazy.all = true
+	return nil
+}
+
+//copyGroup returns a copy of g which shares nothing with it
+func copyGroup(g *Group) *Group {
+	return &Group{
+		Name:    g.Name,
+		Parents: append([]string{}, g.Parents...),
+		Nodes:   append(Nodes{}, g.Nodes...),
+	}
+}
+
+//copyUser returns a copy of u which shares nothing with it
+func copyUser(u *User) *User {
+	return &User{
+		Name:   u.Name,
+		Groups: append([]string{}, u.Groups...),
+		Nodes:  append(Nodes{}, u.Nodes...),
+	}
+}
+
+//MemoryStore is a Store which keeps copies of users and groups in memory.
+//It is safe for concurrent use.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+	users  map[string]*User
+}
+
+//NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		groups: make(map[string]*Group, 20),
+		users:  make(map[string]*User, 20),
+	}
+}
+
+//Load returns copies of every group and user in s in order
+func (s *MemoryStore) Load() ([]*Group, []*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	groups := make([]*Group, 0, len(s.groups))
+	for _, name := range s.groupNames() {
+		groups = append(groups, copyGroup(s.groups[name]))
+	}
+	users := make([]*User, 0, len(s.users))
+	for _, name := range s.userNames() {
+		users = append(users, copyUser(s.users[name]))
+	}
+	return groups, users, nil
+}
+
+//SaveGroup stores a copy of g
+func (s *MemoryStore) SaveGroup(g *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[g.Name] = copyGroup(g)
+	return nil
+}
+
+//SaveUser stores a copy of u
+func (s *MemoryStore) SaveUser(u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.Name] = copyUser(u)
+	return nil
+}
+
+//DelGroup deletes a group
+func (s *MemoryStore) DelGroup(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.groups, name)
+	return nil
+}
+
+//DelUser deletes a user
+func (s *MemoryStore) DelUser(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, name)
+	return nil
+}
+
+//GroupNames returns the names of every group in s in order
+func (s *MemoryStore) GroupNames() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groupNames(), nil
+}
+
+//UserNames returns the names of every user in s in order
+func (s *MemoryStore) UserNames() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.userNames(), nil
+}
+
+//groupNames returns the names of every group in s in order. s must be locked.
+func (s *MemoryStore) groupNames() []string {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//userNames returns the names of every user in s in order. s must be locked.
+func (s *MemoryStore) userNames() []string {
+	names := make([]string, 0, len(s.users))
+	for name := range s.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,267 @@
+package perms
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+//testStore checks a web writes through to s and can be loaded back from it
+func testStore(t *testing.T, s Store) {
+	web := NewWeb()
+	if err := web.SetStore(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.AddPConf(testWeb().MasterPConf()); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.AddUser(&User{Name: "Carl", Groups: []string{"manager"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.DelUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := web.DelGroup("project_lead"); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewWeb()
+	if err := loaded.SetStore(s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.MasterPConf(), web.MasterPConf()) {
+		t.Errorf("loaded %+v, want %+v", loaded.MasterPConf(), web.MasterPConf())
+	}
+
+	groups, err := s.GroupNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"default", "manager"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("GroupNames() = %v, want %v", groups, want)
+	}
+	users, err := s.UserNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Carl", "ammar"}; !reflect.DeepEqual(users, want) {
+		t.Errorf("UserNames() = %v, want %v", users, want)
+	}
+
+	//renaming under a normalization policy must not leave the old names behind
+	if err := web.SetNormalization(Normalization{FoldCase: true}); err != nil {
+		t.Fatal(err)
+	}
+	if users, _ := s.UserNames(); !reflect.DeepEqual(users, []string{"ammar", "carl"}) {
+		t.Errorf("UserNames() after SetNormalization() = %v", users)
+	}
+	if err := web.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if groups, users, _ := s.Load(); len(groups) != 0 || len(users) != 0 {
+		t.Errorf("Reset() left %v groups and %v users in the store", len(groups), len(users))
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+
+	//the store keeps copies
+	s := NewMemoryStore()
+	g := &Group{Name: "manager", Nodes: MustParseNodes(strings.NewReader("projects.*"))}
+	s.SaveGroup(g)
+	g.Nodes[0] = MustParseNode("-projects.*")
+	groups, _, _ := s.Load()
+	if groups[0].Nodes.String() != "projects.*" {
+		t.Errorf("changing a saved group changed the store")
+	}
+}
+
+//testDB opens an empty in memory SQLite database
+func testDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//every connection to :memory: is a different database
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestSQLStore(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	s, err := NewSQLStore(db, PlaceholderQuestion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	//creating the schema twice is harmless
+	if _, err := NewSQLStore(db, PlaceholderDollar); err != nil {
+		t.Errorf("NewSQLStore() on an existing schema = %v", err)
+	}
+}
+
+//countingStore counts the users loaded one at a time
+type countingStore struct {
+	*SQLStore
+	loads int
+}
+
+func (s *countingStore) LoadUser(name string) (*User, error) {
+	s.loads++
+	return s.SQLStore.LoadUser(name)
+}
+
+func TestSQLStore_Lazy(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+	s, err := NewSQLStore(db, PlaceholderQuestion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWeb().SetStore(s); err != nil {
+		t.Fatal(err)
+	}
+	source := testWeb()
+	for _, name := range source.GroupNames() {
+		s.SaveGroup(source.GetGroup(name))
+	}
+	for _, name := range source.UserNames() {
+		s.SaveUser(source.GetUser(name))
+	}
+
+	//references are rows in order
+	var groups []string
+	rows, err := db.Query("SELECT group_name FROM perms_user_groups WHERE user_name = 'ammar' ORDER BY seq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var group string
+		rows.Scan(&group)
+		groups = append(groups, group)
+	}
+	rows.Close()
+	if want := []string{"project_lead", "manager"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("memberships of ammar = %v, want %v", groups, want)
+	}
+
+	counting := &countingStore{SQLStore: s}
+	web := NewWeb()
+	if err := web.SetStore(counting); err != nil {
+		t.Fatal(err)
+	}
+	if len(web.users) != 0 || len(web.groups) != 3 {
+		t.Fatalf("SetStore() loaded %v users and %v groups, want 0 and 3", len(web.users), len(web.groups))
+	}
+
+	for i := 0; i < 2; i++ {
+		if !web.CheckUserHasPermission("ammar", MustParseNode("projects.webserver.build")) {
+			t.Errorf("ammar was not loaded")
+		}
+		if web.CheckUserHasPermission("carl", MustParseNode("profile.use")) {
+			t.Errorf("carl does not exist")
+		}
+	}
+	if counting.loads != 2 || len(web.users) != 1 {
+		t.Errorf("checks loaded users %v times, want 2", counting.loads)
+	}
+
+	//saving a user only changes its own rows
+	ammar := web.GetUser("ammar")
+	ammar.Groups = ammar.Groups[:1]
+	if err := web.AddUser(ammar); err != nil {
+		t.Fatal(err)
+	}
+	want := testWeb()
+	want.GetUser("ammar").Groups = []string{"project_lead"}
+	loaded := NewWeb()
+	if err := loaded.SetStore(s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.MasterPConf(), want.MasterPConf()) {
+		t.Errorf("stored %+v, want %+v", loaded.MasterPConf(), want.MasterPConf())
+	}
+	web.MasterPConf()
+	if counting.loads != 2 || len(web.users) != 2 {
+		t.Errorf("MasterPConf() did not load every user at once")
+	}
+
+	//checks may run concurrently while users load
+	concurrent := NewWeb()
+	concurrent.SetStore(s)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			concurrent.CheckUserHasPermission("ammar", MustParseNode("analytics.view"))
+			concurrent.CheckUserHasPermission("bob", MustParseNode("analytics.view"))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSQLStore_Placeholder(t *testing.T) {
+	s := &SQLStore{placeholder: PlaceholderDollar}
+	if got, want := s.query("INSERT INTO t VALUES (?, ?, ?)"), "INSERT INTO t VALUES ($1, $2, $3)"; got != want {
+		t.Errorf("query() = %q, want %q", got, want)
+	}
+}
+
+//failingStore is a store which fails to save or delete
+type failingStore struct {
+	*MemoryStore
+}
+
+var errStore = errors.New("store is down")
+
+func (failingStore) SaveGroup(*Group) error { return errStore }
+func (failingStore) SaveUser(*User) error   { return errStore }
+func (failingStore) DelGroup(string) error  { return errStore }
+func (failingStore) DelUser(string) error   { return errStore }
+
+//userFailingStore is a store which fails to save users
+type userFailingStore struct {
+	*MemoryStore
+}
+
+func (userFailingStore) SaveUser(*User) error { return errStore }
+
+func TestWeb_StoreFailure(t *testing.T) {
+	web := testWeb()
+	if err := web.SetStore(failingStore{NewMemoryStore()}); err != nil {
+		t.Fatal(err)
+	}
+	if len(web.UserNames()) != 0 {
+		t.Fatalf("SetStore() kept the users of the web")
+	}
+	web.SetStore(nil)
+	web.AddPConf(testWeb().MasterPConf())
+	web.store = failingStore{NewMemoryStore()}
+
+	tests := map[string]error{
+		"AddUser":  web.AddUser(&User{Name: "carl"}),
+		"DelUser":  web.DelUser("ammar"),
+		"AddGroup": web.AddGroup(&Group{Name: "auditor"}),
+		"DelGroup": web.DelGroup("manager"),
+		"AddPConf": web.AddPConf(MustParsePConf([]byte(`{"users": {"dan": {}}}`))),
+		"Reset":    web.Reset(),
+	}
+	for name, err := range tests {
+		if errors.Cause(err) != errStore {
+			t.Errorf("%v() = %v, want %v", name, err, errStore)
+		}
+	}
+	if !reflect.DeepEqual(web.MasterPConf(), testWeb().MasterPConf()) {
+		t.Errorf("failed writes changed the web")
+	}
+}
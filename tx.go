@@ -0,0 +1,292 @@
+package perms
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//ErrMissingGroup is returned when an update leaves a user or group referring to a group which does not exist
+var ErrMissingGroup = errors.New("group does not exist")
+
+//ErrGroupCycle is returned when an update makes a group its own parent, directly or not
+var ErrGroupCycle = errors.New("group cycle")
+
+//Tx stages changes to a Web made by Update.
+//Nothing it stages is visible to the web until Update commits.
+type Tx struct {
+	web *Web
+	//groups and users hold the staged users and groups, nil if deleted
+	groups map[string]*Group
+	users  map[string]*User
+}
+
+//Update applies the changes fn stages on tx to w all at once.
+//If fn returns an error, or the changes leave a user or group referring to a group which does not exist
+//or make a group its own parent, nothing is changed and the error is returned.
+//References which were already missing before the update are not checked.
+//
+//The changes are recorded as AuditUpdate events, make one version and are published as one BatchApplied event.
+//tx must not be used once fn returns.
+//If w has a store, the changes are saved to it before w changes and w is unchanged if that fails,
+//though some of the users and groups may have been saved to it.
+//Nothing is deleted from the store unless everything was saved.
+func (w *Web) Update(fn func(tx *Tx) error) error {
+	return w.update(fn, true)
+}
+
+//update applies the changes fn stages, validating them if validate is set
+func (w *Web) update(fn func(tx *Tx) error, validate bool) error {
+	tx := &Tx{web: w, groups: make(map[string]*Group), users: make(map[string]*User)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if validate {
+		if err := tx.validate(); err != nil {
+			return err
+		}
+	}
+	groups, users := tx.groupNames(), tx.userNames()
+
+	if w.store != nil {
+		for _, name := range groups {
+			if g := tx.groups[name]; g != nil {
+				if err := w.store.SaveGroup(g); err != nil {
+					return err
+				}
+			}
+		}
+		for _, name := range users {
+			if u := tx.users[name]; u != nil {
+				if err := w.store.SaveUser(u); err != nil {
+					return err
+				}
+			}
+		}
+		//nothing is deleted until everything is saved, so a failure cannot lose a renamed user or group
+		for _, name := range users {
+			if tx.users[name] == nil {
+				if err := w.store.DelUser(name); err != nil {
+					return err
+				}
+			}
+		}
+		for _, name := range groups {
+			if tx.groups[name] == nil {
+				if err := w.store.DelGroup(name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	var events []AuditEvent
+	if w.tracking() {
+		for _, name := range groups {
+			before, after := w.groupState(name), auditGroup(tx.groups[name])
+			if !reflect.DeepEqual(before, after) {
+				events = append(events, AuditEvent{Action: AuditUpdate, Kind: "group", Name: name, Before: before, After: after})
+			}
+		}
+		for _, name := range users {
+			before, after := w.userState(name), auditUser(tx.users[name])
+			if !reflect.DeepEqual(before, after) {
+				events = append(events, AuditEvent{Action: AuditUpdate, Kind: "user", Name: name, Before: before, After: after})
+			}
+		}
+	}
+
+	for _, name := range groups {
+		if g := tx.groups[name]; g != nil {
+			w.groups[name] = g
+			w.groupStates[name] = auditGroup(g)
+		} else {
+			delete(w.groups, name)
+			delete(w.groupStates, name)
+		}
+		delete(w.groupSources, name)
+	}
+	for _, name := range users {
+		if u := tx.users[name]; u != nil {
+			w.users[name] = u
+			w.userStates[name] = auditUser(u)
+		} else {
+			if w.lazy != nil {
+				w.lazy.mu.Lock()
+				w.lazy.absent[name] = true
+				w.lazy.mu.Unlock()
+			}
+			delete(w.users, name)
+			delete(w.userStates, name)
+		}
+		delete(w.userSources, name)
+	}
+	return w.commit(events...)
+}
+
+//GetUser returns a copy of the user with name as it would be after the update, or nil if there is none.
+//Changes to the copy are only staged once it is passed to AddUser.
+func (tx *Tx) GetUser(name string) *User {
+	name = tx.web.norm.Normalize(name)
+	if u, staged := tx.users[name]; staged {
+		if u == nil {
+			return nil
+		}
+		return copyUser(u)
+	}
+	if u := tx.web.user(name); u != nil {
+		return copyUser(u)
+	}
+	return nil
+}
+
+//GetGroup returns a copy of the group with name as it would be after the update, or nil if there is none.
+//Changes to the copy are only staged once it is passed to AddGroup.
+func (tx *Tx) GetGroup(name string) *Group {
+	name = tx.web.norm.Normalize(name)
+	if g, staged := tx.groups[name]; staged {
+		if g == nil {
+			return nil
+		}
+		return copyGroup(g)
+	}
+	if g := tx.web.groups[name]; g != nil {
+		return copyGroup(g)
+	}
+	return nil
+}
+
+//AddUser stages adding u, like Web.AddUser
+func (tx *Tx) AddUser(u *User) {
+	tx.web.normalizeUser(u)
+	tx.users[u.Name] = u
+}
+
+//DelUser stages deleting the user with name
+func (tx *Tx) DelUser(name string) {
+	tx.users[tx.web.norm.Normalize(name)] = nil
+}
+
+//AddGroup stages adding g, like Web.AddGroup
+func (tx *Tx) AddGroup(g *Group) {
+	tx.web.normalizeGroup(g)
+	tx.groups[g.Name] = g
+}
+
+//DelGroup stages deleting the group with name
+func (tx *Tx) DelGroup(name string) {
+	tx.groups[tx.web.norm.Normalize(name)] = nil
+}
+
+//group returns the group with name as it would be after the update
+func (tx *Tx) group(name string) *Group {
+	if g, staged := tx.groups[name]; staged {
+		return g
+	}
+	return tx.web.groups[name]
+}
+
+//groupNames returns the names of the staged groups in order
+func (tx *Tx) groupNames() []string {
+	names := make([]string, 0, len(tx.groups))
+	for name := range tx.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//userNames returns the names of the staged users in order
+func (tx *Tx) userNames() []string {
+	names := make([]string, 0, len(tx.users))
+	for name := range tx.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//validate checks that the staged changes refer to groups which exist and make no cycles
+func (tx *Tx) validate() error {
+	var deleted []string
+	for _, name := range tx.groupNames() {
+		g := tx.groups[name]
+		if g == nil {
+			if tx.web.groups[name] != nil {
+				deleted = append(deleted, name)
+			}
+			continue
+		}
+		var had []string
+		if existing := tx.web.groups[name]; existing != nil {
+			had = existing.Parents
+		}
+		for _, parent := range difference(g.Parents, had) {
+			if tx.group(parent) == nil {
+				return errors.Wrapf(ErrMissingGroup, "parent %q of group %q", parent, name)
+			}
+		}
+		if err := tx.cycle([]string{name}); err != nil {
+			return err
+		}
+	}
+	for _, name := range tx.userNames() {
+		if u := tx.users[name]; u != nil {
+			var had []string
+			if existing := tx.web.user(name); existing != nil {
+				had = existing.Groups
+			}
+			for _, group := range difference(u.Groups, had) {
+				if tx.group(group) == nil {
+					return errors.Wrapf(ErrMissingGroup, "group %q of user %q", group, name)
+				}
+			}
+		}
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	//nothing left may refer to a deleted group
+	if err := tx.web.loadUsers(); err != nil {
+		return err
+	}
+	for _, name := range deleted {
+		for _, other := range mergeNames(tx.web.GroupNames(), tx.groupNames()) {
+			if g := tx.group(other); g != nil && len(difference([]string{name}, g.Parents)) == 0 {
+				return errors.Wrapf(ErrMissingGroup, "deleted group %q is a parent of group %q", name, other)
+			}
+		}
+		for _, other := range mergeNames(tx.web.UserNames(), tx.userNames()) {
+			u, staged := tx.users[other]
+			if !staged {
+				u = tx.web.users[other]
+			}
+			if u != nil && len(difference([]string{name}, u.Groups)) == 0 {
+				return errors.Wrapf(ErrMissingGroup, "deleted group %q has user %q", name, other)
+			}
+		}
+	}
+	return nil
+}
+
+//cycle checks if the parents of the last group in path lead back to a group in path
+func (tx *Tx) cycle(path []string) error {
+	g := tx.group(path[len(path)-1])
+	if g == nil {
+		return nil
+	}
+	for _, parent := range g.Parents {
+		for i, name := range path {
+			if name == parent {
+				return errors.Wrap(ErrGroupCycle, strings.Join(append(path[i:len(path):len(path)], parent), " -> "))
+			}
+		}
+		if err := tx.cycle(append(path[:len(path):len(path)], parent)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package perms
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+//storedTestWeb returns testWeb saved to a store
+func storedTestWeb(t *testing.T) (*Web, *MemoryStore) {
+	web, store := NewWeb(), NewMemoryStore()
+	web.SetStore(store)
+	if err := web.AddPConf(testWeb().MasterPConf()); err != nil {
+		t.Fatal(err)
+	}
+	return web, store
+}
+
+func TestWeb_Update(t *testing.T) {
+	web := testWeb()
+	history := NewHistory(0)
+	web.SetHistory(history)
+	var events []Event
+	web.Subscribe(func(e Event) {
+		//checks see every change at once
+		if !web.CheckUserHasPermission("ammar", MustParseNode("analytics.view")) || web.GetGroup("project_lead") != nil {
+			t.Errorf("%v was published before every change was made", e.Type)
+		}
+		events = append(events, e)
+	})
+
+	//rename project_lead to analyst
+	err := web.Update(func(tx *Tx) error {
+		lead := tx.GetGroup("project_lead")
+		lead.Name = "analyst"
+		tx.AddGroup(lead)
+		for _, name := range []string{"ammar", "bob"} {
+			u := tx.GetUser(name)
+			u.Groups[0] = "analyst"
+			tx.AddUser(u)
+		}
+		if web.GetUser("bob").Groups[0] != "project_lead" {
+			t.Errorf("a staged change was visible before Update returned")
+		}
+		tx.DelGroup("project_lead")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+
+	want := []Event{{Type: BatchApplied, Batch: []Event{
+		{Type: GroupAdded, Name: "analyst"},
+		{Type: GroupRemoved, Name: "project_lead"},
+		{Type: MembershipChanged, Name: "ammar", Added: []string{"analyst"}, Removed: []string{"project_lead"}},
+		{Type: MembershipChanged, Name: "bob", Added: []string{"analyst"}, Removed: []string{"project_lead"}},
+	}}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	if v := history.Versions(); len(v) != 2 {
+		t.Errorf("Update() made %v versions, want 1", len(v)-1)
+	}
+}
+
+func TestWeb_Update_Invalid(t *testing.T) {
+	errAbort := errors.New("abort")
+	tests := []struct {
+		name string
+		fn   func(tx *Tx) error
+		err  error
+	}{
+		{"aborted", func(tx *Tx) error {
+			tx.DelUser("ammar")
+			return errAbort
+		}, errAbort},
+		{"missing group", func(tx *Tx) error {
+			tx.AddUser(&User{Name: "carl", Groups: []string{"auditor"}})
+			return nil
+		}, ErrMissingGroup},
+		{"missing parent", func(tx *Tx) error {
+			tx.AddGroup(&Group{Name: "auditor", Parents: []string{"analyst"}})
+			return nil
+		}, ErrMissingGroup},
+		{"deleted group in use", func(tx *Tx) error {
+			tx.DelGroup("manager")
+			tx.AddGroup(&Group{Name: "auditor", Nodes: MustParseNodes(strings.NewReader("analytics.view"))})
+			return nil
+		}, ErrMissingGroup},
+		{"cycle", func(tx *Tx) error {
+			tx.AddGroup(&Group{Name: "project_lead", Parents: []string{"manager"}})
+			tx.AddGroup(&Group{Name: "manager", Parents: []string{"auditor"}})
+			tx.AddGroup(&Group{Name: "auditor", Parents: []string{"project_lead"}})
+			return nil
+		}, ErrGroupCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			web, store := storedTestWeb(t)
+			var events []Event
+			web.Subscribe(func(e Event) { events = append(events, e) })
+
+			if err := web.Update(tt.fn); errors.Cause(err) != tt.err {
+				t.Errorf("Update() = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(web.MasterPConf(), testWeb().MasterPConf()) || len(events) != 0 {
+				t.Errorf("a failed Update() changed the web")
+			}
+			if groups, _ := store.GroupNames(); len(groups) != 3 {
+				t.Errorf("a failed Update() changed the store: %v", groups)
+			}
+		})
+	}
+}
+
+func TestWeb_Update_Store(t *testing.T) {
+	web, store := storedTestWeb(t)
+	var audited []string
+	web.SetAuditSink(AuditFunc(func(e AuditEvent) error {
+		audited = append(audited, e.Action+" "+e.Name)
+		return nil
+	}))
+
+	err := web.Update(func(tx *Tx) error {
+		tx.DelUser("bob")
+		tx.AddUser(tx.GetUser("ammar"))
+		tx.AddGroup(&Group{Name: "auditor", Parents: []string{"default"}})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"update auditor", "update bob"}; !reflect.DeepEqual(audited, want) {
+		t.Errorf("audited %v, want %v", audited, want)
+	}
+	restored := NewWeb()
+	restored.SetStore(store)
+	if !reflect.DeepEqual(restored.MasterPConf(), web.MasterPConf()) {
+		t.Errorf("store = %+v, want %+v", restored.MasterPConf(), web.MasterPConf())
+	}
+}
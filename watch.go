@@ -0,0 +1,321 @@
+package perms
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+//DefaultDebounce is how long a Watcher waits for files to stop changing by default
+const DefaultDebounce = 100 * time.Millisecond
+
+//WatchConfig configures a Watcher
+type WatchConfig struct {
+	//Setup prepares each new web before the files are added to it,
+	//for instance by setting its normalization policy, merge strategy or registry
+	Setup func(w *Web) error
+	//Validate checks each new web before it replaces the active one
+	Validate func(w *Web) error
+	//OnReload is called with each web which replaces the active one.
+	//It is called with the watcher locked, so it must not call Reload.
+	OnReload func(w *Web)
+	//OnError is called when reloading in the background fails. The active web is kept.
+	OnError func(err error)
+	//Debounce is how long the files must stop changing before they are reloaded, DefaultDebounce if 0
+	Debounce time.Duration
+	//Poll makes the watcher check the files for changes every Poll instead of relying on file system notifications.
+	//Watchers poll every second when notifications are unavailable.
+	Poll time.Duration
+}
+
+//Watcher keeps a Web loaded from PConf files, reloading it when they change.
+//
+//Each path is a PConf file or a directory, whose files in a known format are loaded in order, see FormatOf.
+//Files they include are watched too. Every reload builds a new web,
+//which only replaces the active one if every file loads and the web validates,
+//so a bad edit never takes effect: it is reported to OnError and the last good web is kept.
+type Watcher struct {
+	paths  []string
+	config WatchConfig
+	//active holds the active *Web
+	active atomic.Value
+
+	//mu is held while reloading and replacing the active web
+	mu sync.Mutex
+	//files are the files the last reload read or failed to read, including the files they include
+	files []string
+	//loaded is the fingerprint of the files when they were last reloaded
+	loaded string
+
+	notify  *fsnotify.Watcher
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+//NewWatcher loads paths and watches them until Close is called.
+//It fails if the files can not be loaded the first time.
+func NewWatcher(paths []string, config WatchConfig) (*Watcher, error) {
+	if config.Debounce <= 0 {
+		config.Debounce = DefaultDebounce
+	}
+	w := &Watcher{
+		paths:   paths,
+		config:  config,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+
+	if w.config.Poll <= 0 {
+		notify, err := fsnotify.NewWatcher()
+		if err != nil {
+			w.config.Poll = time.Second
+		} else {
+			w.notify = notify
+			if err := w.watchDirs(); err != nil {
+				notify.Close()
+				w.notify = nil
+				w.config.Poll = time.Second
+			}
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+//Web returns the active web. It must not be changed, as it is shared with every caller.
+func (w *Watcher) Web() *Web {
+	return w.active.Load().(*Web)
+}
+
+//Close stops watching the files. The active web stays usable.
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+	}
+	close(w.done)
+	<-w.stopped
+	if w.notify != nil {
+		return w.notify.Close()
+	}
+	return nil
+}
+
+//Reload reads the files now and replaces the active web if they load and validate.
+//Failures are returned rather than reported to OnError.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	web, err := w.reload()
+	if err != nil {
+		return err
+	}
+	//replacing it while locked keeps a slower reload from replacing a newer web
+	w.active.Store(web)
+	if w.config.OnReload != nil {
+		w.config.OnReload(web)
+	}
+	return nil
+}
+
+//reload builds a web from the files. w must be locked.
+func (w *Watcher) reload() (*Web, error) {
+	paths, pathsErr := expandPaths(w.paths)
+	//each file is described as it was before it was read, so changes made while reloading are noticed
+	stats := make(map[string]string)
+	for _, path := range append(paths, w.files...) {
+		stats[path] = stat(path)
+	}
+	//tried holds every file read, including one which failed, so fixing it is noticed
+	var tried []string
+	//whatever happens, these files need not be reloaded until they change again
+	defer func() {
+		w.files = tried
+		w.loaded = w.fingerprint(paths, pathsErr, func(path string) string {
+			return stats[path]
+		})
+	}()
+	if pathsErr != nil {
+		return nil, pathsErr
+	}
+
+	var files []PConfFile
+	for _, path := range paths {
+		read, err := readPConfFile(path, func(file string) {
+			stats[file] = stat(file)
+			tried = append(tried, file)
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, read...)
+	}
+
+	web := NewWeb()
+	if w.config.Setup != nil {
+		if err := w.config.Setup(web); err != nil {
+			return nil, errors.Wrap(err, "failed to set up web")
+		}
+	}
+	if err := web.addPConfFiles(files); err != nil {
+		return nil, err
+	}
+	if w.config.Validate != nil {
+		if err := w.config.Validate(web); err != nil {
+			return nil, errors.Wrap(err, "invalid permissions")
+		}
+	}
+	return web, nil
+}
+
+//expandPaths replaces the directories in paths with the files in them in a known format, in order
+func expandPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if _, err := FormatOf(e.Name()); err == nil && !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+//stat describes the size and modification time of the file at path
+func stat(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "missing"
+	}
+	return fmt.Sprintf("%v %v", info.Size(), info.ModTime().UnixNano())
+}
+
+//fingerprint describes the watched files, given paths expanded by expandPaths and the state of each file.
+//w must be locked.
+func (w *Watcher) fingerprint(paths []string, pathsErr error, state func(path string) string) string {
+	buf := new(bytes.Buffer)
+	if pathsErr != nil {
+		fmt.Fprintf(buf, "%v\n", pathsErr)
+	}
+	for _, path := range append(paths, w.files...) {
+		fmt.Fprintf(buf, "%v %v\n", path, state(path))
+	}
+	return buf.String()
+}
+
+//changed returns the current fingerprint and checks if it differs from the one last reloaded
+func (w *Watcher) changed() (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	paths, err := expandPaths(w.paths)
+	fingerprint := w.fingerprint(paths, err, stat)
+	return fingerprint, fingerprint != w.loaded
+}
+
+//watchDirs watches the directories holding the files for notifications.
+//Directories are watched rather than files so files replaced by renaming them are noticed.
+func (w *Watcher) watchDirs() error {
+	w.mu.Lock()
+	dirs := make(map[string]bool)
+	for _, path := range w.paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dirs[path] = true
+		} else {
+			dirs[filepath.Dir(path)] = true
+		}
+	}
+	for _, file := range w.files {
+		dirs[filepath.Dir(file)] = true
+	}
+	w.mu.Unlock()
+
+	for dir := range dirs {
+		if err := w.notify.Add(dir); err != nil {
+			return errors.Wrapf(err, "failed to watch %v", dir)
+		}
+	}
+	return nil
+}
+
+//fail reports err to OnError
+func (w *Watcher) fail(err error) {
+	if w.config.OnError != nil {
+		w.config.OnError(err)
+	}
+}
+
+//run reloads the files once they have stopped changing for the debounce interval
+func (w *Watcher) run() {
+	defer close(w.stopped)
+
+	var events <-chan fsnotify.Event
+	var notifyErrors <-chan error
+	if w.notify != nil {
+		events, notifyErrors = w.notify.Events, w.notify.Errors
+	}
+	var tick <-chan time.Time
+	if w.config.Poll > 0 {
+		ticker := time.NewTicker(w.config.Poll)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	//fire is set while waiting for the files to stop changing
+	var fire <-chan time.Time
+	//seen is the fingerprint at the last poll
+	var seen string
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-events:
+			fire = time.After(w.config.Debounce)
+		case err := <-notifyErrors:
+			w.fail(errors.Wrap(err, "failed to watch files"))
+		case <-tick:
+			if fingerprint, changed := w.changed(); changed && fingerprint != seen {
+				fire = time.After(w.config.Debounce)
+				seen = fingerprint
+			}
+		case <-fire:
+			fire = nil
+			if _, changed := w.changed(); !changed {
+				continue
+			}
+			if err := w.Reload(); err != nil {
+				w.fail(err)
+			}
+			//reloading may have found new includes
+			if w.notify != nil {
+				if err := w.watchDirs(); err != nil {
+					w.fail(err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package perms
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//watchTest watches a temporary directory
+type watchTest struct {
+	t       *testing.T
+	dir     string
+	watcher *Watcher
+	reloads chan *Web
+	errors  chan error
+}
+
+func newWatchTest(t *testing.T, files map[string]string, config WatchConfig) *watchTest {
+	wt := &watchTest{t: t, dir: writeTree(t, files), reloads: make(chan *Web, 10), errors: make(chan error, 10)}
+	config.OnReload = func(w *Web) { wt.reloads <- w }
+	config.OnError = func(err error) { wt.errors <- err }
+	var err error
+	wt.watcher, err = NewWatcher([]string{wt.dir}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-wt.reloads
+	return wt
+}
+
+func (wt *watchTest) close() {
+	if err := wt.watcher.Close(); err != nil {
+		wt.t.Error(err)
+	}
+}
+
+func (wt *watchTest) write(name string, content string) {
+	if err := ioutil.WriteFile(filepath.Join(wt.dir, name), []byte(content), 0644); err != nil {
+		wt.t.Fatal(err)
+	}
+}
+
+//wait waits for a reload or an error
+func (wt *watchTest) wait() (*Web, error) {
+	select {
+	case w := <-wt.reloads:
+		return w, nil
+	case err := <-wt.errors:
+		return nil, err
+	case <-time.After(5 * time.Second):
+		wt.t.Fatal("nothing was reloaded")
+	}
+	return nil, nil
+}
+
+func testWatcher(t *testing.T, config WatchConfig) {
+	wt := newWatchTest(t, map[string]string{
+		"groups.json":       `{"include": ["shared/leads.yaml"], "groups": {"manager": {"nodes": ["projects.*"]}}}`,
+		"users.toml":        "[users.ammar]\ngroups = [\"manager\"]\n",
+		"notes.txt":         "not a pconf",
+		"shared/leads.yaml": "groups:\n    project_lead:\n        nodes: [analytics.*]\n",
+	}, config)
+	defer wt.close()
+	check := func(w *Web, user string, node string) bool {
+		return w.CheckUserHasPermission(user, MustParseNode(node))
+	}
+	if !check(wt.watcher.Web(), "ammar", "projects.webserver") {
+		t.Fatalf("the directory was not loaded")
+	}
+
+	wt.write("users.toml", "[users.ammar]\ngroups = [\"manager\", \"project_lead\"]\n")
+	w, err := wt.wait()
+	if err != nil || !check(w, "ammar", "analytics.view") || wt.watcher.Web() != w {
+		t.Fatalf("changing a file did not reload, %v", err)
+	}
+
+	//a bad edit keeps the last good web
+	wt.write("users.toml", "[users.ammar]\ngroups = \"manager\"\n")
+	if _, err := wt.wait(); err == nil {
+		t.Fatalf("a bad file was loaded")
+	}
+	if !check(wt.watcher.Web(), "ammar", "analytics.view") {
+		t.Errorf("the active web changed after a failed reload")
+	}
+
+	//included files are watched too
+	wt.write("users.toml", "[users.ammar]\ngroups = [\"project_lead\"]\n")
+	if _, err := wt.wait(); err != nil {
+		t.Fatal(err)
+	}
+	wt.write(filepath.Join("shared", "leads.yaml"), "groups:\n    project_lead:\n        nodes: [analytics.*, reports.*]\n")
+	w, err = wt.wait()
+	if err != nil || !check(w, "ammar", "reports.daily") {
+		t.Errorf("changing an included file did not reload, %v", err)
+	}
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	testWatcher(t, WatchConfig{Poll: 10 * time.Millisecond, Debounce: 30 * time.Millisecond})
+}
+
+func TestWatcher_Notify(t *testing.T) {
+	testWatcher(t, WatchConfig{Debounce: 30 * time.Millisecond})
+}
+
+func TestWatcher_ChangedWhileReloading(t *testing.T) {
+	//Setup runs once the files are read, so an edit it makes is one made while reloading
+	dirs := make(chan string, 1)
+	var setups int
+	wt := newWatchTest(t, map[string]string{"perms.json": `{"users": {"ammar": {"nodes": ["projects.*"]}}}`}, WatchConfig{
+		Poll:     10 * time.Millisecond,
+		Debounce: 10 * time.Millisecond,
+		Setup: func(w *Web) error {
+			setups++
+			if setups == 2 {
+				edited := `{"users": {"ammar": {"nodes": ["projects.*", "analytics.*"]}}}`
+				if err := ioutil.WriteFile(filepath.Join(<-dirs, "perms.json"), []byte(edited), 0644); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	defer wt.close()
+	dirs <- wt.dir
+
+	wt.write("perms.json", `{"users": {"ammar": {}}}`)
+	if _, err := wt.wait(); err != nil {
+		t.Fatal(err)
+	}
+	w, err := wt.wait()
+	if err != nil || !w.CheckUserHasPermission("ammar", MustParseNode("analytics.view")) {
+		t.Errorf("the edit made while reloading was not reloaded, %v", err)
+	}
+}
+
+func TestWatcher_FixedInclude(t *testing.T) {
+	for name, config := range map[string]WatchConfig{
+		"poll":   {Poll: 10 * time.Millisecond, Debounce: 30 * time.Millisecond},
+		"notify": {Debounce: 30 * time.Millisecond},
+	} {
+		t.Run(name, func(t *testing.T) {
+			wt := newWatchTest(t, map[string]string{
+				"perms.json":        `{"users": {"ammar": {"nodes": ["projects.*"]}}}`,
+				"shared/extra.json": `{"users": {"bob": {"nodes": ["bad node"]}}}`,
+			}, config)
+			defer wt.close()
+
+			wt.write("perms.json", `{"include": ["shared/extra.json"], "users": {"ammar": {"nodes": ["projects.*"]}}}`)
+			if _, err := wt.wait(); err == nil {
+				t.Fatalf("an invalid include was reloaded")
+			}
+			//only the included file changes, so it must be watched though it failed to load
+			wt.write("shared/extra.json", `{"users": {"bob": {"nodes": ["analytics.*"]}}}`)
+			w, err := wt.wait()
+			if err != nil || !w.CheckUserHasPermission("bob", MustParseNode("analytics.view")) {
+				t.Errorf("fixing the include did not reload, %v", err)
+			}
+		})
+	}
+}
+
+func TestWatcher_Validate(t *testing.T) {
+	errEmpty := errors.New("nobody can do anything")
+	wt := newWatchTest(t, map[string]string{"perms.json": `{"users": {"ammar": {"nodes": ["projects.*"]}}}`}, WatchConfig{
+		Poll:     10 * time.Millisecond,
+		Debounce: 10 * time.Millisecond,
+		Setup: func(w *Web) error {
+			w.SetMergeStrategy(MergeError)
+			return nil
+		},
+		Validate: func(w *Web) error {
+			if len(w.UserNames()) == 0 {
+				return errEmpty
+			}
+			return nil
+		},
+	})
+	defer wt.close()
+
+	wt.write("perms.json", `{}`)
+	if _, err := wt.wait(); errors.Cause(err) != errEmpty {
+		t.Errorf("error = %v, want %v", err, errEmpty)
+	}
+	wt.write("more.json", `{"users": {"ammar": {}}}`)
+	wt.write("perms.json", `{"users": {"ammar": {"nodes": ["projects.*"]}}}`)
+	if _, err := wt.wait(); errors.Cause(err) != ErrConflict {
+		t.Errorf("error = %v, want ErrConflict from the merge strategy Setup set", err)
+	}
+	if len(wt.watcher.Web().UserNames()) != 1 {
+		t.Errorf("the active web changed after failed reloads")
+	}
+
+	if _, err := NewWatcher([]string{filepath.Join(wt.dir, "missing.json")}, WatchConfig{}); err == nil {
+		t.Errorf("NewWatcher() watched a missing file")
+	}
+}
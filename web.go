@@ -4,14 +4,37 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/pkg/errors"
 )
 
 //Web is an isolated permissions system
 type Web struct {
-	groups map[string]*Group
-	users  map[string]*User
+	groups   map[string]*Group
+	users    map[string]*User
+	norm     Normalization
+	registry *Registry
+	merge    MergeStrategy
+	//deletePolicy is what DelGroup does with the users and groups in the deleted group
+	deletePolicy DeletePolicy
+	store        Store
+	//lazy is set if users are loaded from store as they are needed
+	lazy    *lazyUsers
+	audit   AuditSink
+	actor   string
+	history *History
+	feed    *Feed
+	//quiet is set while w is loaded from its store, which is not a change to commit
+	quiet bool
+	subs  subscribers
+	//groupSources and userSources hold the source each was added from by AddPConfFrom
+	groupSources map[string]string
+	userSources  map[string]string
+	//groupStates and userStates hold the audited state of each as it was last added,
+	//which differs from the group or user if it was changed through a pointer returned by GetGroup or GetUser since
+	groupStates map[string]*AuditEntity
+	userStates  map[string]*AuditEntity
 }
 
 //NewWeb returns an instantiated web
@@ -21,97 +44,482 @@ func NewWeb() *Web {
 	return w
 }
 
-//Reset resets the state of w
-func (w *Web) Reset() {
+//Reset resets the state of w.
+//The normalization policy, merge strategy, store and audit sink are kept.
+//If w has a store, every user and group of w is deleted from it first.
+func (w *Web) Reset() error {
+	if err := w.loadUsers(); err != nil {
+		return err
+	}
+	if w.store != nil {
+		for _, name := range w.GroupNames() {
+			if err := w.store.DelGroup(name); err != nil {
+				return err
+			}
+		}
+		for _, name := range w.UserNames() {
+			if err := w.store.DelUser(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	var events []AuditEvent
+	if w.tracking() {
+		for _, name := range w.GroupNames() {
+			events = append(events, AuditEvent{Action: AuditReset, Kind: "group", Name: name, Before: w.groupState(name)})
+		}
+		for _, name := range w.UserNames() {
+			events = append(events, AuditEvent{Action: AuditReset, Kind: "user", Name: name, Before: w.userState(name)})
+		}
+	}
 	w.groups = make(map[string]*Group, 20)
 	w.users = make(map[string]*User, 20)
+	w.groupSources = make(map[string]string, 20)
+	w.userSources = make(map[string]string, 20)
+	w.groupStates = make(map[string]*AuditEntity, 20)
+	w.userStates = make(map[string]*AuditEntity, 20)
+	return w.commit(events...)
 }
 
-//AddPConf adds a PConf to the web
-func (w *Web) AddPConf(p *PConf) error {
-	for name, unprocessedGroup := range p.Groups {
-		group := NewGroup(name)
-		w.groups[name] = group
-
-		for _, nodeStr := range unprocessedGroup.Nodes {
-			node, err := ParseNode(nodeStr)
-			if err != nil {
-				return errors.Wrapf(err, "failed to parse node %q", nodeStr)
-			}
-			group.Nodes = append(group.Nodes, node)
+//commit finishes a change to w.
+//events are recorded to the audit sink, the new state of w is added to its history
+//and the change is published to listeners.
+func (w *Web) commit(events ...AuditEvent) error {
+	if w.quiet {
+		return nil
+	}
+	err := w.record(events...)
+	if w.history != nil {
+		w.history.add(w.MasterPConf(), w.actor)
+	}
+	if w.feed != nil && len(events) > 0 {
+		w.feed.add(feedChange(events))
+	}
+	w.publish(changeEvents(events)...)
+	return err
+}
+
+//reloaded finishes loading or rebuilding w, which replaces everything at once
+func (w *Web) reloaded() {
+	if w.feed != nil {
+		w.feed.add(Change{Snapshot: w.MasterPConf()})
+	}
+	w.publish(Event{Type: ConfigReloaded})
+}
+
+//Store returns the store of w, or nil if it has none
+func (w *Web) Store() Store {
+	return w.store
+}
+
+//SetStore replaces the users and groups of w with the ones in s and attaches s to w.
+//From then on, users and groups added to w are saved to s and deleted ones are deleted from it.
+//Changes made through pointers returned by GetUser and GetGroup are only saved
+//once they are passed back to AddUser or AddGroup.
+//If s is a LazyStore, users are loaded the first time they are needed
+//and anything which lists them, such as UserNames, loads all of them.
+//w is unchanged if s can not be loaded. A nil s detaches the store and keeps the users and groups of w.
+func (w *Web) SetStore(s Store) error {
+	if s == nil {
+		if err := w.loadUsers(); err != nil {
+			return err
 		}
-		group.Parents = unprocessedGroup.Parents
+		w.store, w.lazy = nil, nil
+		return nil
+	}
+
+	lazy, isLazy := s.(LazyStore)
+	var groups []*Group
+	var users []*User
+	var err error
+	if isLazy {
+		groups, err = lazy.LoadGroups()
+	} else {
+		groups, users, err = s.Load()
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to load store")
+	}
+
+	w.store, w.lazy, w.quiet = nil, nil, true
+	w.Reset()
+	for _, g := range groups {
+		w.AddGroup(g)
+	}
+	for _, u := range users {
+		w.AddUser(u)
+	}
+	w.store, w.quiet = s, false
+	if isLazy {
+		w.lazy = &lazyUsers{store: lazy, absent: make(map[string]bool)}
+	}
+	w.reloaded()
+	return nil
+}
+
+//Normalization returns the normalization policy of w
+func (w *Web) Normalization() Normalization {
+	return w.norm
+}
+
+//SetNormalization changes how w compares namespaces and user and group names.
+//Existing users and groups are rebuilt under the new policy,
+//so pointers previously returned by GetUser and GetGroup are no longer part of w.
+//Names which become equal are merged according to the merge strategy of w.
+//Nothing is changed if an error is returned, though if w has a store, some of the users and groups may have been saved to it.
+func (w *Web) SetNormalization(nz Normalization) error {
+	if err := w.loadUsers(); err != nil {
+		return errors.Wrap(err, "failed to normalize")
+	}
+	target := NewWeb()
+	target.norm, target.merge = nz, w.merge
+	if err := target.AddPConf(w.MasterPConf()); err != nil {
+		return errors.Wrap(err, "failed to normalize")
+	}
+	for name, source := range w.groupSources {
+		target.groupSources[nz.Normalize(name)] = source
+	}
+	for name, source := range w.userSources {
+		target.userSources[nz.Normalize(name)] = source
+	}
+	if err := w.saveReplacement(target); err != nil {
+		return errors.Wrap(err, "failed to normalize")
 	}
-	for name, unprocessedUser := range p.Users {
-		user := NewUser(name)
-		w.users[name] = user
 
-		for _, nodeStr := range unprocessedUser.Nodes {
-			node, err := ParseNode(nodeStr)
-			if err != nil {
-				return errors.Wrapf(err, "failed to parse node %q", nodeStr)
+	w.norm = nz
+	w.groups, w.users = target.groups, target.users
+	w.groupSources, w.userSources = target.groupSources, target.userSources
+	w.groupStates, w.userStates = target.groupStates, target.userStates
+	w.reloaded()
+	return nil
+}
+
+//saveReplacement saves the users and groups of target to the store of w, if any,
+//and deletes the ones of w which target does not have.
+//Everything is saved before anything is deleted, so a failure leaves extra entries in the store rather than missing ones.
+//Every user of w must be loaded.
+func (w *Web) saveReplacement(target *Web) error {
+	if w.store == nil {
+		return nil
+	}
+	for _, name := range target.GroupNames() {
+		if err := w.store.SaveGroup(target.groups[name]); err != nil {
+			return err
+		}
+	}
+	for _, name := range target.UserNames() {
+		if err := w.store.SaveUser(target.users[name]); err != nil {
+			return err
+		}
+	}
+	for _, name := range w.GroupNames() {
+		if target.groups[name] == nil {
+			if err := w.store.DelGroup(name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range w.UserNames() {
+		if target.users[name] == nil {
+			if err := w.store.DelUser(name); err != nil {
+				return err
 			}
-			user.Nodes = append(user.Nodes, node)
 		}
-		user.Groups = unprocessedUser.Groups
 	}
 	return nil
 }
 
-//AddUser adds a user to the web
-func (w *Web) AddUser(u *User) {
+//Registry returns the permission registry of w, or nil if it has none
+func (w *Web) Registry() *Registry {
+	return w.registry
+}
+
+//SetRegistry attaches a permission registry to w.
+//Checks of unregistered nodes are then treated according to the mode of r,
+//and registered permissions granted by default are granted to users who match no node for them.
+//A nil r detaches the registry.
+func (w *Web) SetRegistry(r *Registry) {
+	w.registry = r
+}
+
+//ParseNode parses a permission node under the normalization policy of w
+func (w *Web) ParseNode(raw string) (Node, error) {
+	return w.norm.ParseNode(raw)
+}
+
+//AddPConf adds a PConf to the web.
+//Users and groups which already exist are merged according to the merge strategy of w.
+func (w *Web) AddPConf(p *PConf) error {
+	return w.AddPConfFrom("", p)
+}
+
+//AddUser adds a user to the web.
+//It instantiates nil values and normalizes u under the normalization policy of w.
+//If w has a store, u is saved to it first and w is unchanged if that fails.
+func (w *Web) AddUser(u *User) error {
+	w.normalizeUser(u)
+	var before *AuditEntity
+	if w.tracking() {
+		before = w.userState(u.Name)
+	}
+	after := auditUser(u)
+	if w.store != nil {
+		if err := w.store.SaveUser(u); err != nil {
+			return err
+		}
+	}
+	w.users[u.Name] = u
+	w.userStates[u.Name] = after
+	delete(w.userSources, u.Name)
+	return w.commit(AuditEvent{Action: AuditAddUser, Kind: "user", Name: u.Name, Before: before, After: after})
+}
+
+//normalizeUser instantiates nil values and normalizes u under the normalization policy of w
+func (w *Web) normalizeUser(u *User) {
 	if u.Groups == nil {
 		u.Groups = []string{}
 	}
 	if u.Nodes == nil {
 		u.Nodes = Nodes{}
 	}
-	w.users[u.Name] = u
+	u.Name = w.norm.Normalize(u.Name)
+	u.Groups = w.norm.Names(u.Groups)
+	u.Nodes = w.norm.Nodes(u.Nodes)
 }
 
 //GetUser returns a user with name
 func (w *Web) GetUser(name string) *User {
-	return w.users[name]
+	return w.user(w.norm.Normalize(name))
 }
 
-//DelUser deletes a user
-func (w *Web) DelUser(name string) {
+//DelUser deletes a user.
+//If w has a store, the user is deleted from it first and w is unchanged if that fails.
+func (w *Web) DelUser(name string) error {
+	name = w.norm.Normalize(name)
+	var before *AuditEntity
+	if w.tracking() {
+		before = w.userState(name)
+	}
+	if w.store != nil {
+		if err := w.store.DelUser(name); err != nil {
+			return err
+		}
+	}
+	if w.lazy != nil {
+		w.lazy.mu.Lock()
+		w.lazy.absent[name] = true
+		w.lazy.mu.Unlock()
+	}
 	delete(w.users, name)
+	delete(w.userSources, name)
+	delete(w.userStates, name)
+	return w.commit(AuditEvent{Action: AuditDelUser, Kind: "user", Name: name, Before: before})
 }
 
 //AddGroup adds a group to the web.
-//It instantiates nil values
-func (w *Web) AddGroup(g *Group) {
+//It instantiates nil values and normalizes g under the normalization policy of w.
+//If w has a store, g is saved to it first and w is unchanged if that fails.
+func (w *Web) AddGroup(g *Group) error {
+	w.normalizeGroup(g)
+	var before *AuditEntity
+	if w.tracking() {
+		before = w.groupState(g.Name)
+	}
+	after := auditGroup(g)
+	if w.store != nil {
+		if err := w.store.SaveGroup(g); err != nil {
+			return err
+		}
+	}
+	w.groups[g.Name] = g
+	w.groupStates[g.Name] = after
+	delete(w.groupSources, g.Name)
+	return w.commit(AuditEvent{Action: AuditAddGroup, Kind: "group", Name: g.Name, Before: before, After: after})
+}
+
+//normalizeGroup instantiates nil values and normalizes g under the normalization policy of w
+func (w *Web) normalizeGroup(g *Group) {
 	if g.Nodes == nil {
 		g.Nodes = Nodes{}
 	}
 	if g.Parents == nil {
 		g.Parents = []string{}
 	}
-	w.groups[g.Name] = g
+	g.Name = w.norm.Normalize(g.Name)
+	g.Parents = w.norm.Names(g.Parents)
+	g.Nodes = w.norm.Nodes(g.Nodes)
 }
 
 //GetGroup gets a group. It returns nil if no group of name exists in web
 func (w *Web) GetGroup(name string) *Group {
-	return w.groups[name]
+	return w.groups[w.norm.Normalize(name)]
 }
 
-//DelGroup deletes a group from the web
-func (w *Web) DelGroup(name string) {
+//DelGroup deletes a group from the web.
+//The users and groups in it are kept, removed from it at once like Update or make it fail according to the delete policy of w.
+//If w has a store, the group is deleted from it first and w is unchanged if that fails.
+func (w *Web) DelGroup(name string) error {
+	name = w.norm.Normalize(name)
+	if w.deletePolicy != DeleteKeep && w.groups[name] != nil {
+		if referrer := w.referrer(name); referrer != "" {
+			if w.deletePolicy == DeleteRefuse {
+				return errors.Wrapf(ErrGroupInUse, "%v is in group %q", referrer, name)
+			}
+			return w.Update(func(tx *Tx) error {
+				tx.DelGroup(name)
+				tx.replaceGroup(name, "")
+				return nil
+			})
+		}
+	}
+	var before *AuditEntity
+	if w.tracking() {
+		before = w.groupState(name)
+	}
+	if w.store != nil {
+		if err := w.store.DelGroup(name); err != nil {
+			return err
+		}
+	}
 	delete(w.groups, name)
+	delete(w.groupSources, name)
+	delete(w.groupStates, name)
+	return w.commit(AuditEvent{Action: AuditDelGroup, Kind: "group", Name: name, Before: before})
+}
+
+//UserNames returns the names of every user in w in order
+func (w *Web) UserNames() []string {
+	w.loadUsers()
+	names := make([]string, 0, len(w.users))
+	for name := range w.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//GroupNames returns the names of every group in w in order
+func (w *Web) GroupNames() []string {
+	names := make([]string, 0, len(w.groups))
+	for name := range w.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//UsersWithPermission returns the names of the users who have a permission in order
+func (w *Web) UsersWithPermission(check Node) []string {
+	names := make([]string, 0, 10)
+	for _, name := range w.UserNames() {
+		if w.CheckUserHasPermission(name, check) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+//Effective returns the nodes a user is granted by itself and its groups, simplified.
+//Permissions granted by default by the registry are not included.
+func (w *Web) Effective(name string) (Effective, error) {
+	user := w.user(w.norm.Normalize(name))
+	if user == nil {
+		return Effective{}, errors.Errorf("user %q does not exist", name)
+	}
+
+	//a negation in any group denies a node unless the user grants it directly
+	groups := make(Nodes, 0, 10)
+	if defaultGroup, exists := w.groups["default"]; exists {
+		groups = append(groups, defaultGroup.Nodes...)
+	}
+	for _, groupName := range user.Groups {
+		if group := w.groups[groupName]; group != nil {
+			groups = append(groups, group.Nodes...)
+		}
+	}
+	groups, _ = groups.Simplify()
+
+	//the user's negations apply to its groups too, so only drop the ones which negate nothing at all
+	grants, negations := user.Nodes.split()
+	own, _ := Nodes(grants).Simplify()
+	for _, n := range negations {
+		if Nodes(grants).disjoint(n) && groups.disjoint(n) {
+			continue
+		}
+		var covered bool
+		for _, other := range negations {
+			if other.String() != n.String() && Covers(other, n) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			own = appendUnique(own, n)
+		}
+	}
+
+	return Effective{User: own, Groups: groups}, nil
 }
 
 //CheckUserHasPermission checks is a user has a permission.
 //It is negation aware.
 func (w *Web) CheckUserHasPermission(name string, check Node) bool {
-	user := w.users[name]
+	check = w.norm.Node(check)
+
+	var perm Permission
+	if w.registry != nil {
+		var known bool
+		perm, known = w.registry.lookup(check, w.norm)
+		if !w.registry.allow(known, func() Node { return check }) {
+			return false
+		}
+	}
+
+	return w.checkUser(name, perm.Default, func(ns Nodes) (bool, bool) {
+		return ns.Check(check)
+	})
+}
+
+//CheckUserHasPermissionString checks if a user has the permission check would parse to.
+//It does not allocate unless w has a normalization policy. Unparseable checks are never granted.
+func (w *Web) CheckUserHasPermissionString(name string, check string) bool {
+	if w.norm != (Normalization{}) {
+		node, err := w.ParseNode(check)
+		if err != nil {
+			return false
+		}
+		return w.CheckUserHasPermission(name, node)
+	}
+	if !validNodeString(check) {
+		return false
+	}
+
+	var perm Permission
+	if w.registry != nil {
+		var known bool
+		perm, known = w.registry.lookupString(check)
+		if !w.registry.allow(known, func() Node { return MustParseNode(check) }) {
+			return false
+		}
+	}
+
+	return w.checkUser(name, perm.Default, func(ns Nodes) (bool, bool) {
+		return ns.CheckString(check)
+	})
+}
+
+//checkUser walks the permissions of a user with check.
+//It is negation aware. grantDefault grants the permission if nothing matches it.
+func (w *Web) checkUser(name string, grantDefault bool, check func(Nodes) (matched bool, negated bool)) bool {
+	user := w.user(w.norm.Normalize(name))
 
 	if user == nil {
 		return false
 	}
 
 	//Check user's direct permissions first
-	matched, negated := user.Nodes.Check(check)
+	matched, negated := check(user.Nodes)
 
 	if negated {
 		return false
@@ -122,7 +530,7 @@ func (w *Web) CheckUserHasPermission(name string, check Node) bool {
 	//Matched has to be false here
 
 	if defaultGroup, exists := w.groups["default"]; exists {
-		thisMatched, negated := defaultGroup.Nodes.Check(check)
+		thisMatched, negated := check(defaultGroup.Nodes)
 		if negated {
 			return false
 		}
@@ -130,7 +538,6 @@ func (w *Web) CheckUserHasPermission(name string, check Node) bool {
 			matched = true
 		}
 	}
-	//fmt.Printf("Node %v Matched %v\n", check, matched)
 
 	//Check user's groups for permissions
 	for _, groupName := range user.Groups {
@@ -138,7 +545,7 @@ func (w *Web) CheckUserHasPermission(name string, check Node) bool {
 		if group == nil {
 			continue
 		}
-		thisMatched, negated := group.Nodes.Check(check)
+		thisMatched, negated := check(group.Nodes)
 		if negated {
 			//If it is ever negated now we know they don't have the node
 			return false
@@ -147,23 +554,23 @@ func (w *Web) CheckUserHasPermission(name string, check Node) bool {
 			matched = true
 		}
 	}
-	//fmt.Printf("Node %v Matched %v\n", check, matched)
 
-	return matched
+	return matched || grantDefault
 }
 
-//MasterPConf generates a serialized master pconf
+//MasterPConf generates a serialized master pconf, which shares nothing with w
 func (w *Web) MasterPConf() (pconf *PConf) {
+	w.loadUsers()
 	pc := newPConf()
 	for name, group := range w.groups {
 		pc.Groups[name] = pconfGroup{
-			Parents: group.Parents,
+			Parents: append([]string{}, group.Parents...),
 			Nodes:   group.Nodes.Strings(),
 		}
 	}
 	for name, user := range w.users {
 		pc.Users[name] = pconfUser{
-			Groups: user.Groups,
+			Groups: append([]string{}, user.Groups...),
 			Nodes:  user.Nodes.Strings(),
 		}
 	}
@@ -180,13 +587,14 @@ func (w *Web) MarshalJSON() ([]byte, error) {
 func (w *Web) UnmarshalJSON(b []byte) error {
 	pconf, err := ParsePConf(b)
 	if err != nil {
-		errors.Wrap(err, "failed to parse pconf")
+		return errors.Wrap(err, "failed to parse pconf")
 	}
 	return errors.Wrap(w.AddPConf(pconf), "failed to add pconf")
 }
 
 //PrettyDump outputs a pretty version of the web to a writer
 func (w *Web) PrettyDump(wr io.Writer) error {
+	w.loadUsers()
 	bufw := bufio.NewWriter(wr)
 
 	fmt.Fprintf(bufw, "%v Groups\n", len(w.groups))
@@ -7,6 +7,8 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/pkg/errors"
 )
 
 func TestWeb_AddPConf(t *testing.T) {
@@ -158,4 +160,97 @@ func TestWeb_JSON(t *testing.T) {
 			t.Errorf("Failed to unmarshal: %v", err)
 		}
 	})
+
+	t.Run("UnmarshalJSON_Invalid", func(t *testing.T) {
+		web := NewWeb()
+		err := json.Unmarshal([]byte(`{"groups":{"a":{"parent":["x"]}}}`), web)
+		if _, ok := errors.Cause(err).(*SchemaError); !ok {
+			t.Errorf("Unmarshal() = %v, want a SchemaError", err)
+		}
+	})
+}
+
+func TestWeb_CheckUserHasPermissionString(t *testing.T) {
+	web := NewWeb()
+	web.AddGroup(&Group{Name: "default", Nodes: MustParseNodes(strings.NewReader("profile.use"))})
+	web.AddGroup(&Group{Name: "admin", Nodes: MustParseNodes(strings.NewReader("billing.* -billing.delete"))})
+	web.AddUser(&User{Name: "ammar", Groups: []string{"admin"}, Nodes: MustParseNodes(strings.NewReader("projects.*"))})
+
+	for _, check := range []string{"profile.use", "billing.view", "billing.delete", "projects.x", "analytics.view", "bad check"} {
+		want := false
+		if node, err := ParseNode(check); err == nil {
+			want = web.CheckUserHasPermission("ammar", node)
+		}
+		if got := web.CheckUserHasPermissionString("ammar", check); got != want {
+			t.Errorf("CheckUserHasPermissionString(%q) = %v, want %v", check, got, want)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		web.CheckUserHasPermissionString("ammar", "billing.view")
+	})
+	if allocs != 0 {
+		t.Errorf("CheckUserHasPermissionString allocated %v times", allocs)
+	}
+}
+
+func TestWeb_Effective(t *testing.T) {
+	web := testWeb()
+	web.AddUser(&User{Name: "carl", Groups: []string{"manager"}, Nodes: MustParseNodes(strings.NewReader("-projects.*.chat.* -billing.*"))})
+
+	checks := []string{
+		"projects.webserver.build", "projects.webserver.chat.moderate", "projects.secret.build",
+		"projects.secret.view", "analytics.view", "profile.use", "billing.view",
+	}
+
+	for _, name := range []string{"ammar", "bob", "carl"} {
+		got, err := web.Effective(name)
+		if err != nil {
+			t.Fatalf("Effective() error = %v", err)
+		}
+		flat, flatErr := got.Nodes()
+
+		for _, u := range checks {
+			check := MustParseNode(u)
+			want := web.CheckUserHasPermission(name, check)
+			if got.Check(check) != want {
+				t.Errorf("Effective(%q) = %+v disagrees on %v", name, got, u)
+			}
+			if flatErr == nil && granted(flat, check) != want {
+				t.Errorf("Effective(%q).Nodes() = %q disagrees on %v", name, flat, u)
+			}
+		}
+	}
+
+	carl, _ := web.Effective("carl")
+	if carl.User.String() != "-projects.*.chat.*" {
+		t.Errorf("negations which negate nothing should be dropped, got %q", carl.User)
+	}
+	flat, err := carl.Nodes()
+	if err != nil || flat.String() != "profile.use\nprojects.*\n-projects.secret.*\n-projects.*.chat.*" {
+		t.Errorf("Nodes() = %q, %v", flat, err)
+	}
+
+	ammar, _ := web.Effective("ammar")
+	if _, err := ammar.Nodes(); err != ErrUnrepresentable {
+		t.Errorf("Nodes() error = %v, want %v", err, ErrUnrepresentable)
+	}
+
+	if _, err := web.Effective("dave"); err == nil {
+		t.Errorf("Effective() of a missing user should fail")
+	}
+}
+
+func TestWeb_UsersWithPermission(t *testing.T) {
+	web := testWeb()
+
+	if got := web.UsersWithPermission(MustParseNode("analytics.view")); !reflect.DeepEqual(got, []string{"ammar", "bob"}) {
+		t.Errorf("UsersWithPermission() = %v", got)
+	}
+	if got := web.UsersWithPermission(MustParseNode("projects.secret.view")); len(got) != 0 {
+		t.Errorf("UsersWithPermission() = %v", got)
+	}
+	if got := web.GroupNames(); !reflect.DeepEqual(got, []string{"default", "manager", "project_lead"}) {
+		t.Errorf("GroupNames() = %v", got)
+	}
 }